@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"github.com/yakovleviga/brokerService/internal/cache"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,87 +11,250 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/yakovleviga/brokerService/internal/api"
+	"github.com/yakovleviga/brokerService/internal/auth"
+	"github.com/yakovleviga/brokerService/internal/broker"
+	"github.com/yakovleviga/brokerService/internal/cache"
 	"github.com/yakovleviga/brokerService/internal/config"
 	"github.com/yakovleviga/brokerService/internal/consumer"
 	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/health"
+	"github.com/yakovleviga/brokerService/internal/lifecycle"
+	"github.com/yakovleviga/brokerService/internal/logger"
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/outbox"
+	"github.com/yakovleviga/brokerService/internal/ratelimit"
+	"github.com/yakovleviga/brokerService/internal/redact"
 	"github.com/yakovleviga/brokerService/internal/service"
+	"github.com/yakovleviga/brokerService/internal/tracing"
+	"github.com/yakovleviga/brokerService/internal/validation"
+	"github.com/yakovleviga/brokerService/internal/warmup"
 )
 
 func main() {
-	// Загружаем .env, если есть
-	if _, err := os.Stat(".env"); err == nil {
-		if err := godotenv.Load(".env"); err != nil {
-			log.Println("Ошибка загрузки .env:", err)
-		} else {
-			log.Println("Загружен файл .env")
-		}
-	} else {
-		log.Println("Файл .env не найден — берем окружение из environment compose-yml")
-	}
+	// Загружаем .env, если есть. Логгер еще не настроен, поэтому
+	// результат запоминаем и пишем в лог после загрузки конфигурации.
+	envErr := godotenv.Load(".env")
+	deprecated := config.ApplyDeprecatedEnv()
 
 	var cfg config.AppConfig
 	if err := envconfig.Process("", &cfg); err != nil {
-		log.Fatal(errors.Wrap(err, "failed to load configuration"))
+		slog.Error("failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	redactor, err := redact.NewRedactor(cfg.Redaction)
+	if err != nil {
+		slog.Error("invalid redaction rules", "error", err)
+		os.Exit(1)
+	}
+
+	// PII в логах маскируются всегда, независимо от прав вызывающей стороны
+	log := slog.New(redact.NewHandler(logger.New(cfg.LogLevel, cfg.LogFormat).Handler(), redactor))
+	slog.SetDefault(log)
+
+	switch {
+	case envErr == nil:
+		log.Info(".env file loaded")
+	case os.IsNotExist(envErr):
+		log.Info(".env file not found, using process environment")
+	default:
+		log.Warn("failed to load .env file", "error", envErr)
+	}
+	for old, name := range deprecated {
+		log.Warn("deprecated environment variable", "name", old, "use", name)
 	}
 
-	c := cache.NewCache()
+	fatal := func(msg string, err error) {
+		log.Error(msg, "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to initialize tracing", err)
+	}
+
+	c := cache.NewCache(cfg.Cache)
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err := db.RunMigrations(cfg.PostgreSQL); err != nil {
-		log.Fatal(err)
+	if err := db.RunMigrations(cfg.PostgreSQL, log); err != nil {
+		fatal("failed to run migrations", err)
 	}
 
-	repository, err := db.NewRepository(ctx, cfg.PostgreSQL)
+	repository, err := db.NewRepository(ctx, cfg.PostgreSQL, log)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "failed to initialize repository"))
+		fatal("failed to initialize repository", err)
 	}
 
 	ctxPing, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	if err := repository.Ping(ctxPing); err != nil {
-		log.Fatal(errors.Wrap(err, "failed to ping database"))
+		fatal("failed to ping database", err)
+	}
+	log.Info("connected to database")
+
+	prometheus.MustRegister(c.Collector())
+	metrics.RegisterPool(repository.Stat)
+
+	serviceInstance := service.NewService(repository, c, redactor, cfg.Rest, log)
+
+	warmer := warmup.NewWarmer(repository, c, cfg.Warmup, log)
+
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.Register(health.Check{
+		Name:     "postgres",
+		Critical: true,
+		Timeout:  cfg.Health.PostgresTimeout,
+		Fn:       repository.Ping,
+	})
+	checker.Register(health.Check{
+		Name:     "cache_warmup",
+		Critical: true,
+		Fn:       warmer.Check,
+		Details:  func() any { return warmer.Progress() },
+	})
+	brk, err := broker.Open(ctx, cfg.Broker, cfg.Kafka, cfg.NATS, log)
+	if err != nil {
+		fatal("failed to connect to message broker", err)
+	}
+	log.Info("message broker configured", "broker", brk.Name)
+
+	// Без брокера чтение заказов продолжает работать, поэтому проверка некритичная
+	checker.Register(health.Check{
+		Name:    brk.Name,
+		Timeout: cfg.Health.KafkaTimeout,
+		Fn:      brk.Ping,
+	})
+
+	authProviders, err := auth.NewProviders(cfg.Auth, repository)
+	if err != nil {
+		fatal("failed to configure authentication", err)
+	}
+	if !cfg.Auth.Enabled {
+		log.Warn("authentication disabled, API is open with anonymous scopes", "scopes", cfg.Auth.AnonymousScopes)
+	} else if len(authProviders) == 0 {
+		log.Warn("authentication enabled but no API keys or JWKS configured, all API requests will be rejected")
+	}
+
+	limiter, err := ratelimit.NewLimiter(cfg.RateLimit, ratelimit.NewMemoryStore(cfg.RateLimit.IdleTTL), log)
+	if err != nil {
+		fatal("invalid rate limit configuration", err)
 	}
-	log.Println("Подключение к базе данных успешно")
 
-	serviceInstance := service.NewService(repository, c)
+	app := api.NewRouters(&api.Routers{
+		Service:     *serviceInstance,
+		Health:      checker,
+		Auth:        auth.NewAuthenticator(cfg.Auth, authProviders...),
+		RateLimit:   limiter,
+		CORSOrigins: cfg.Rest.CORSAllowOrigins,
+		Logger:      log,
+	})
 
-	app := api.NewRouters(&api.Routers{Service: *serviceInstance})
+	warmupDone := make(chan struct{})
+	go func() {
+		defer close(warmupDone)
+		warmer.Run(ctx)
+	}()
 
-	LoadCacheFromDB(repository, c)
-	cache.PrintCache(c)
+	validator := validation.NewValidator(cfg.Validation)
+	orderConsumer := consumer.NewConsumer(cfg.Consumer, brk.Source, brk.DLQ, brk.Quarantine, consumer.NewRetryPolicy(cfg.Consumer), repository, c, validator, log)
 
+	serverErr := make(chan error, 1)
 	go func() {
-		fmt.Printf("Starting server on %s\n", cfg.Rest.ListenAddress)
+		log.Info("starting http server", "addr", cfg.Rest.ListenAddress)
 		if err := app.Listen(cfg.Rest.ListenAddress); err != nil {
-			log.Fatal(errors.Wrap(err, "failed to start server"))
+			serverErr <- errors.Wrap(err, "failed to start server")
 		}
 	}()
 
-	go consumer.ConsumeKafka(repository, c)
-
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
-	<-signalChan
-
-	log.Println("Shutting down gracefully...")
-	// TODO: Добавить логику graceful shutdown, если нужно
-}
+	consumerDone := make(chan error, 1)
+	go func() {
+		consumerDone <- orderConsumer.Run(ctx)
+	}()
 
-func LoadCacheFromDB(repo db.Repository, c *cache.Cache) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Без relay'я события копятся в outbox и уйдут после его включения
+	relayDone := make(chan error, 1)
+	var publisher outbox.Publisher
+	if cfg.Outbox.Enabled && brk.Name != broker.Kafka {
+		log.Warn("outbox relay publishes to kafka only, disabled for this broker", "broker", brk.Name)
+		relayDone <- nil
+	} else if cfg.Outbox.Enabled {
+		publisher, err = outbox.NewKafkaPublisher(cfg.Kafka, cfg.Outbox.Topic)
+		if err != nil {
+			fatal("failed to create outbox publisher", err)
+		}
+		relay := outbox.NewRelay(repository, publisher, cfg.Outbox, log)
+		go func() {
+			relayDone <- relay.Run(ctx)
+		}()
+	} else {
+		log.Warn("outbox relay disabled, order.persisted events are not published")
+		relayDone <- nil
+	}
 
-	orders, err := repo.GetAllOrders(ctx)
-	if err != nil {
-		log.Fatalf("failed to load orders from DB: %v", err)
+	exitCode := 0
+	select {
+	case <-ctx.Done():
+		log.Info("shutting down gracefully")
+	case err := <-serverErr:
+		log.Error("http server failed", "error", err)
+		exitCode = 1
 	}
+	stop()
+
+	// Порядок важен: сначала дочитываем текущее сообщение, затем перестаем
+	// принимать HTTP-запросы, ждем прогрев кэша и relay outbox и только потом
+	// закрываем брокер и пул БД.
+	lm := lifecycle.NewManager(cfg.ShutdownTimeout, log)
+	lm.OnShutdown("consumer", func(ctx context.Context) error {
+		select {
+		case err := <-consumerDone:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	lm.OnShutdown("http", func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		return app.ShutdownWithTimeout(time.Until(deadline))
+	})
+	// Прогрев читает из пула БД, поэтому должен завершиться до его закрытия
+	lm.OnShutdown("warmup", func(ctx context.Context) error {
+		select {
+		case <-warmupDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	lm.OnShutdown("outbox", func(ctx context.Context) error {
+		select {
+		case err := <-relayDone:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	lm.OnShutdown("broker", func(context.Context) error {
+		if publisher != nil {
+			if err := publisher.Close(); err != nil {
+				log.Error("failed to close outbox publisher", "error", err)
+			}
+		}
+		return brk.Close()
+	})
+	lm.OnShutdown("postgres", repository.Close)
+	lm.OnShutdown("tracing", shutdownTracing)
 
-	for _, order := range orders {
-		c.Set(order)
+	if err := lm.Shutdown(); err != nil {
+		log.Error("graceful shutdown failed", "error", err)
+		exitCode = 1
 	}
 
-	log.Printf("Cache loaded with %d orders from DB", len(orders))
+	os.Exit(exitCode)
 }
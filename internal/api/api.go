@@ -1,33 +1,71 @@
 package api
 
 import (
+	"log/slog"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 
+	"github.com/yakovleviga/brokerService/internal/auth"
+	"github.com/yakovleviga/brokerService/internal/health"
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/ratelimit"
 	"github.com/yakovleviga/brokerService/internal/service"
+	"github.com/yakovleviga/brokerService/internal/tracing"
 )
 
 type Routers struct {
-	Service service.OrderService
+	Service     service.OrderService
+	Health      *health.Checker
+	Auth        *auth.Authenticator
+	RateLimit   *ratelimit.Limiter
+	CORSOrigins string
+	Logger      *slog.Logger
 }
 
 func NewRouters(r *Routers) *fiber.App {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+		ErrorHandler:          errorHandler(),
+	})
+
+	app.Use(requestid.New())
+	app.Use(tracing.Middleware())
+	app.Use(requestLogger(r.Logger.With("component", "http")))
+	app.Use(metrics.Middleware())
+	app.Use(handleErrors)
 
 	// Настройка CORS (разрешенные методы, заголовки, авторизация)
 	app.Use(cors.New(cors.Config{
-		AllowMethods:     "GET, POST, PUT, DELETE",
-		AllowHeaders:     "Accept, Content-Type, X-REQUEST-SomeID",
-		ExposeHeaders:    "Link",
+		AllowOrigins:     r.CORSOrigins,
+		AllowMethods:     "GET",
+		AllowHeaders:     "Accept, Content-Type, X-Request-ID, Authorization, X-API-Key",
+		ExposeHeaders:    "Link, X-Request-ID, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset",
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
+	app.Get("/healthz", r.Health.Liveness)
+	app.Get("/readyz", r.Health.Readiness)
+	app.Get("/metrics", metrics.Handler())
+
 	app.Static("/", "./web")
 
-	apiGroup := app.Group("/v1")
+	// Лимит по IP стоит до аутентификации: иначе 401/403 не ограничиваются
+	apiGroup := app.Group("/v1", r.RateLimit.IP(ratelimit.GroupAuth), r.Auth.Middleware())
 
-	apiGroup.Get("/orders/:order_uid", r.Service.GetOrder)
+	// PII в ответах дополнительно зависят от скоупа orders:read:pii (см. redact)
+	read := auth.RequireScope(auth.ScopeOrdersRead)
+	ordersLimit := r.RateLimit.Group(ratelimit.GroupOrders)
+	searchLimit := r.RateLimit.Group(ratelimit.GroupSearch)
+	apiGroup.Get("/orders", read, searchLimit, r.Service.ListOrders)
+	apiGroup.Get("/orders/:order_uid", read, ordersLimit, r.Service.GetOrder)
+	apiGroup.Get("/orders/track/:track_number", read, ordersLimit, r.Service.GetOrderByTrackNumber)
+	apiGroup.Get("/orders/rid/:rid", read, ordersLimit, r.Service.GetOrderByRid)
+	apiGroup.Get("/customers/:customer_id/orders", read, searchLimit, r.Service.GetOrdersByCustomerID)
+	apiGroup.Get("/items/:chrt_id/orders", read, searchLimit, r.Service.GetOrdersByChrtID)
+	apiGroup.Get("/cache/stats", auth.RequireScope(auth.ScopeAdmin), r.RateLimit.Group(ratelimit.GroupAdmin), r.Service.CacheStats)
 
 	return app
 }
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/fiber/v2/utils"
+
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+const mimeProblemJSON = "application/problem+json"
+
+// errorCauseKey — под этим ключом в Locals лежит исходная ошибка 5xx для access-лога
+const errorCauseKey = "error_cause"
+
+// Problem — тело ошибки по RFC 7807
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorHandler переводит ошибки обработчиков в problem+json: типизированные
+// ошибки репозитория — в 404/409/503, *fiber.Error — в его код, остальное — в 500
+// без подробностей.
+func errorHandler() fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		p := problemFor(err)
+		p.Instance = c.OriginalURL()
+		if id, ok := c.Locals(requestid.ConfigDefault.ContextKey).(string); ok {
+			p.RequestID = id
+		}
+
+		if p.Status >= fiber.StatusInternalServerError {
+			c.Locals(errorCauseKey, err)
+			if p.Status == fiber.StatusServiceUnavailable && c.GetRespHeader(fiber.HeaderRetryAfter) == "" {
+				c.Set(fiber.HeaderRetryAfter, "5")
+			}
+		}
+
+		c.Status(p.Status)
+		return c.JSON(p, mimeProblemJSON)
+	}
+}
+
+func problemFor(err error) Problem {
+	var fe *fiber.Error
+	switch {
+	case errors.Is(err, db.ErrOrderNotFound):
+		return Problem{Type: "/problems/order-not-found", Title: "Order not found", Status: fiber.StatusNotFound}
+	case errors.Is(err, db.ErrOrderIncomplete):
+		return Problem{
+			Type:   "/problems/order-incomplete",
+			Title:  "Order is incomplete",
+			Status: fiber.StatusConflict,
+			Detail: "order is stored without delivery or payment data",
+		}
+	case errors.Is(err, db.ErrUnavailable), errors.Is(err, context.DeadlineExceeded):
+		return Problem{
+			Type:   "/problems/service-unavailable",
+			Title:  "Service unavailable",
+			Status: fiber.StatusServiceUnavailable,
+			Detail: "storage is temporarily unavailable, retry later",
+		}
+	case errors.As(err, &fe):
+		p := Problem{Type: "about:blank", Title: utils.StatusMessage(fe.Code), Status: fe.Code}
+		if fe.Message != p.Title {
+			p.Detail = fe.Message
+		}
+		return p
+	default:
+		return Problem{
+			Type:   "about:blank",
+			Title:  utils.StatusMessage(fiber.StatusInternalServerError),
+			Status: fiber.StatusInternalServerError,
+		}
+	}
+}
+
+// handleErrors отвечает на ошибку обработчика сразу, чтобы метрики и
+// access-лог, стоящие выше по цепочке, увидели итоговый статус ответа.
+func handleErrors(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		return c.App().ErrorHandler(c, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yakovleviga/brokerService/internal/logger"
+)
+
+// requestLogger кладет в контекст запроса логгер с request_id (и trace_id,
+// если запрос трассируется) и пишет строку access-лога по завершении.
+func requestLogger(log *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		reqLog := log.With("request_id", c.Locals(requestid.ConfigDefault.ContextKey))
+		if sc := trace.SpanContextFromContext(c.UserContext()); sc.HasTraceID() {
+			reqLog = reqLog.With("trace_id", sc.TraceID().String())
+		}
+		c.SetUserContext(logger.WithContext(c.UserContext(), reqLog))
+
+		err := c.Next()
+
+		// Ошибки к этому моменту уже превращены в ответ (см. handleErrors),
+		// а причина 5xx сохранена в Locals
+		status := c.Response().StatusCode()
+		cause := err
+		if cause == nil {
+			cause, _ = c.Locals(errorCauseKey).(error)
+		}
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		}
+		if cause != nil {
+			// Error(), а не сама ошибка: иначе pkg/errors добавит в лог стек
+			attrs = append(attrs, "error", cause.Error())
+		}
+		reqLog.Log(c.UserContext(), level, "http request", attrs...)
+		return err
+	}
+}
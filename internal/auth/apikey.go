@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+const HeaderAPIKey = "X-API-Key"
+
+// KeyStore ищет ключ по SHA-256 хешу; неизвестный ключ — db.ErrAPIKeyNotFound
+type KeyStore interface {
+	GetAPIKey(ctx context.Context, keyHash string) (*db.APIKey, error)
+}
+
+// HashKey возвращает hex SHA-256 ключа — в таком виде ключи хранятся
+// в конфигурации и в таблице api_keys.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// StaticKeyStore — ключи из AUTH_API_KEYS
+type StaticKeyStore map[string]db.APIKey
+
+// ParseStaticKeys разбирает записи вида имя:sha256-hex:скоуп1|скоуп2
+func ParseStaticKeys(entries []string) (StaticKeyStore, error) {
+	store := make(StaticKeyStore, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, errors.Errorf("api key entry %q must be name:sha256:scopes", entry)
+		}
+		hash := strings.ToLower(parts[1])
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, errors.Errorf("api key %q: hash must be hex-encoded SHA-256", parts[0])
+		}
+		store[hash] = db.APIKey{Name: parts[0], Scopes: strings.Split(parts[2], "|")}
+	}
+	return store, nil
+}
+
+func (s StaticKeyStore) GetAPIKey(_ context.Context, keyHash string) (*db.APIKey, error) {
+	key, ok := s[keyHash]
+	if !ok {
+		return nil, db.ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+// APIKeyProvider принимает ключ из X-API-Key или Authorization: ApiKey <key>
+// и ищет его по очереди в хранилищах.
+type APIKeyProvider struct {
+	stores []KeyStore
+}
+
+func NewAPIKeyProvider(stores ...KeyStore) *APIKeyProvider {
+	return &APIKeyProvider{stores: stores}
+}
+
+func (p *APIKeyProvider) Authenticate(c *fiber.Ctx) (*Principal, error) {
+	key := c.Get(HeaderAPIKey)
+	if key == "" {
+		scheme, value, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+		if strings.EqualFold(scheme, "ApiKey") {
+			key = strings.TrimSpace(value)
+		}
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	hash := HashKey(key)
+	for _, store := range p.stores {
+		apiKey, err := store.GetAPIKey(c.UserContext(), hash)
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "lookup api key")
+		}
+		return &Principal{Subject: apiKey.Name, Method: MethodAPIKey, Scopes: apiKey.Scopes}, nil
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/redact"
+)
+
+const (
+	ScopeOrdersRead    = "orders:read"
+	ScopeOrdersReadPII = "orders:read:pii"
+	// ScopeAdmin включает в себя все остальные скоупы
+	ScopeAdmin = "admin"
+)
+
+// Способ, которым вызывающая сторона подтвердила личность
+const (
+	MethodNone   = "none"
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+var (
+	// ErrNoCredentials — в запросе нет учетных данных для этого провайдера
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials — учетные данные есть, но не прошли проверку
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+type Principal struct {
+	Subject string   `json:"subject"`
+	Method  string   `json:"method"`
+	Scopes  []string `json:"scopes"`
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Provider проверяет учетные данные одного вида. Если подходящих данных в
+// запросе нет, возвращает ErrNoCredentials, и очередь переходит к следующему.
+type Provider interface {
+	Authenticate(c *fiber.Ctx) (*Principal, error)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+type Authenticator struct {
+	enabled   bool
+	anonymous *Principal
+	providers []Provider
+}
+
+func NewAuthenticator(cfg config.Auth, providers ...Provider) *Authenticator {
+	return &Authenticator{
+		enabled:   cfg.Enabled,
+		anonymous: &Principal{Subject: "anonymous", Method: MethodNone, Scopes: cfg.AnonymousScopes},
+		providers: providers,
+	}
+}
+
+// NewProviders собирает провайдеры по конфигурации: API-ключи (статические
+// и, если включено, из таблицы api_keys) и JWT, если задан JWKS-файл.
+func NewProviders(cfg config.Auth, keys KeyStore) ([]Provider, error) {
+	var providers []Provider
+
+	var stores []KeyStore
+	if len(cfg.APIKeys) > 0 {
+		static, err := ParseStaticKeys(cfg.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, static)
+	}
+	if cfg.APIKeysFromDB {
+		stores = append(stores, keys)
+	}
+	if len(stores) > 0 {
+		providers = append(providers, NewAPIKeyProvider(stores...))
+	}
+
+	if cfg.JWKSFile != "" {
+		jwtProvider, err := NewJWTProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, jwtProvider)
+	}
+	return providers, nil
+}
+
+// Middleware определяет вызывающую сторону и кладет ее в контекст запроса.
+// Проверку скоупов конкретного маршрута делает RequireScope.
+func (a *Authenticator) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !a.enabled {
+			return a.next(c, a.anonymous)
+		}
+
+		for _, provider := range a.providers {
+			p, err := provider.Authenticate(c)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if errors.Is(err, ErrInvalidCredentials) {
+				return unauthorized(c, "invalid credentials")
+			}
+			if err != nil {
+				return fiber.NewError(fiber.StatusServiceUnavailable, "authentication unavailable")
+			}
+			return a.next(c, p)
+		}
+		return unauthorized(c, "authentication required")
+	}
+}
+
+func (a *Authenticator) next(c *fiber.Ctx, p *Principal) error {
+	ctx := WithPrincipal(c.UserContext(), p)
+	c.SetUserContext(redact.WithScopes(ctx, p.Scopes))
+	return c.Next()
+}
+
+// RequireScope пропускает запрос, только если у вызывающей стороны есть scope
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, ok := FromContext(c.UserContext())
+		if !ok {
+			return unauthorized(c, "authentication required")
+		}
+		if !p.HasScope(scope) {
+			return fiber.NewError(fiber.StatusForbidden, "missing scope "+scope)
+		}
+		return c.Next()
+	}
+}
+
+func unauthorized(c *fiber.Ctx, msg string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer, ApiKey`)
+	return fiber.NewError(fiber.StatusUnauthorized, msg)
+}
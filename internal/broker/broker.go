@@ -0,0 +1,110 @@
+package broker
+
+import (
+	"context"
+	stderrors "errors"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+)
+
+const (
+	Kafka  = "kafka"
+	NATS   = "nats"
+	Memory = "memory"
+)
+
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message — сообщение брокера в общем для всех реализаций виде. У брокеров
+// без партиций (NATS, память) Partition равна 0, а Offset — номер сообщения
+// в потоке.
+type Message struct {
+	System    string // kafka | nats | memory
+	Topic     string
+	Partition int
+	Offset    int64
+	// HighWaterMark — offset следующего сообщения в партиции, для расчета лага
+	HighWaterMark int64
+	Key           []byte
+	Value         []byte
+	Headers       []Header
+	Time          time.Time
+
+	// raw — исходное сообщение реализации, нужно для Ack/Nack
+	raw any
+}
+
+// MessageSource — входящий поток сообщений
+type MessageSource interface {
+	// Fetch блокируется до следующего сообщения или отмены ctx
+	Fetch(ctx context.Context) (Message, error)
+	// Ack подтверждает обработку: после рестарта сообщения не придут снова
+	Ack(ctx context.Context, msgs ...Message) error
+	// Nack отказывается от сообщения: оно будет доставлено повторно
+	Nack(ctx context.Context, m Message) error
+	Close() error
+}
+
+// Sink — исходящий топик или subject (DLQ, карантин)
+type Sink interface {
+	Publish(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// Broker — источник заказов и приемники DLQ и карантина поверх одного
+// подключения. Закрывается целиком после остановки консьюмера.
+type Broker struct {
+	Name       string
+	Source     MessageSource
+	DLQ        Sink
+	Quarantine Sink
+
+	ping  func(ctx context.Context) error
+	close func() error
+}
+
+// Open подключается к брокеру name (kafka | nats) с соответствующей конфигурацией
+func Open(ctx context.Context, name string, kafkaCfg config.Kafka, natsCfg config.NATS, log *slog.Logger) (*Broker, error) {
+	switch name {
+	case Kafka:
+		return openKafka(kafkaCfg, log)
+	case NATS:
+		return openNATS(ctx, natsCfg, log)
+	default:
+		return nil, errors.Errorf("unknown message broker %q", name)
+	}
+}
+
+// Ping проверяет доступность брокера
+func (b *Broker) Ping(ctx context.Context) error {
+	if b.ping == nil {
+		return nil
+	}
+	return b.ping(ctx)
+}
+
+func (b *Broker) Close() error {
+	var errs []error
+	if err := b.Source.Close(); err != nil {
+		errs = append(errs, errors.Wrap(err, "close message source"))
+	}
+	if err := b.DLQ.Close(); err != nil {
+		errs = append(errs, errors.Wrap(err, "close DLQ"))
+	}
+	if err := b.Quarantine.Close(); err != nil {
+		errs = append(errs, errors.Wrap(err, "close quarantine"))
+	}
+	if b.close != nil {
+		if err := b.close(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "close %s connection", b.Name))
+		}
+	}
+	return stderrors.Join(errs...)
+}
@@ -0,0 +1,301 @@
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/logger"
+)
+
+const writerBatchTimeout = 5 * time.Millisecond
+
+func NewKafkaReader(cfg config.Kafka, log *slog.Logger) (*kafka.Reader, error) {
+	dialer, err := NewKafkaDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	startOffset, err := parseStartOffset(cfg.StartOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		Topic:       cfg.Topic,
+		GroupID:     cfg.GroupID,
+		StartOffset: startOffset,
+		MinBytes:    cfg.MinBytes,
+		MaxBytes:    cfg.MaxBytes,
+		MaxWait:     cfg.MaxWait,
+		Dialer:      dialer,
+		Logger:      logger.Kafka(log, slog.LevelDebug),
+		ErrorLogger: logger.Kafka(log, slog.LevelError),
+		// Коммитим вручную после сохранения заказа
+		CommitInterval: 0,
+		GroupBalancers: []kafka.GroupBalancer{
+			kafka.RangeGroupBalancer{},
+			kafka.RoundRobinGroupBalancer{},
+		},
+	}), nil
+}
+
+func NewKafkaDialer(cfg config.Kafka) (*kafka.Dialer, error) {
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+
+	mechanism, err := saslMechanism(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dialer.SASLMechanism = mechanism
+
+	if cfg.TLSEnabled {
+		tlsConfig, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLS = tlsConfig
+	}
+
+	return dialer, nil
+}
+
+// NewKafkaWriter создает writer в topic с теми же брокерами, SASL и TLS, что у
+// reader'а. Ключ сообщения определяет партицию, запись ждет подтверждения
+// всех реплик.
+//
+// Writer'ы DLQ, карантина и outbox пишут синхронно и всю пачку одним вызовом,
+// поэтому копить сообщения незачем: с BatchTimeout по умолчанию (1s) каждая
+// запись ждала бы секунду.
+func NewKafkaWriter(cfg config.Kafka, topic string) (*kafka.Writer, error) {
+	dialer, err := NewKafkaDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		BatchTimeout:           writerBatchTimeout,
+		AllowAutoTopicCreation: true,
+		Transport: &kafka.Transport{
+			SASL: dialer.SASLMechanism,
+			TLS:  dialer.TLS,
+		},
+	}, nil
+}
+
+func openKafka(cfg config.Kafka, log *slog.Logger) (*Broker, error) {
+	source, err := NewKafkaSource(cfg, log)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kafka reader")
+	}
+
+	dlq, err := NewKafkaSink(cfg, cfg.DLQTopic)
+	if err != nil {
+		source.Close()
+		return nil, errors.Wrap(err, "failed to create DLQ writer")
+	}
+
+	quarantine, err := NewKafkaSink(cfg, cfg.QuarantineTopic)
+	if err != nil {
+		source.Close()
+		dlq.Close()
+		return nil, errors.Wrap(err, "failed to create quarantine writer")
+	}
+
+	return &Broker{
+		Name:       Kafka,
+		Source:     source,
+		DLQ:        dlq,
+		Quarantine: quarantine,
+		ping: func(ctx context.Context) error {
+			return PingKafka(ctx, cfg)
+		},
+	}, nil
+}
+
+// KafkaSource читает топик в consumer group с ручным коммитом offset'ов
+type KafkaSource struct {
+	reader *kafka.Reader
+}
+
+func NewKafkaSource(cfg config.Kafka, log *slog.Logger) (*KafkaSource, error) {
+	reader, err := NewKafkaReader(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaSource{reader: reader}, nil
+}
+
+func (s *KafkaSource) Fetch(ctx context.Context) (Message, error) {
+	m, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+
+	headers := make([]Header, len(m.Headers))
+	for i, h := range m.Headers {
+		headers[i] = Header{Key: h.Key, Value: h.Value}
+	}
+	return Message{
+		System:        Kafka,
+		Topic:         m.Topic,
+		Partition:     m.Partition,
+		Offset:        m.Offset,
+		HighWaterMark: m.HighWaterMark,
+		Key:           m.Key,
+		Value:         m.Value,
+		Headers:       headers,
+		Time:          m.Time,
+		raw:           m,
+	}, nil
+}
+
+// Ack коммитит offset'ы сообщений, а вместе с ними и все предыдущие в
+// партициях. Подтверждать сообщения партиции нужно по порядку.
+func (s *KafkaSource) Ack(ctx context.Context, msgs ...Message) error {
+	kms := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		km, ok := m.raw.(kafka.Message)
+		if !ok {
+			return errors.New("message was not fetched from kafka")
+		}
+		kms[i] = km
+	}
+	return s.reader.CommitMessages(ctx, kms...)
+}
+
+// Nack ничего не делает: незакоммиченное сообщение перечитается после
+// рестарта или ребаланса
+func (s *KafkaSource) Nack(context.Context, Message) error {
+	return nil
+}
+
+func (s *KafkaSource) Close() error {
+	return s.reader.Close()
+}
+
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(cfg config.Kafka, topic string) (*KafkaSink, error) {
+	writer, err := NewKafkaWriter(cfg, topic)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaSink{writer: writer}, nil
+}
+
+func (s *KafkaSink) Publish(ctx context.Context, msgs ...Message) error {
+	out := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		headers := make([]kafka.Header, len(m.Headers))
+		for j, h := range m.Headers {
+			headers[j] = kafka.Header{Key: h.Key, Value: h.Value}
+		}
+		out[i] = kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+	}
+	return s.writer.WriteMessages(ctx, out...)
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+func parseStartOffset(value string) (int64, error) {
+	switch strings.ToLower(value) {
+	case "", "first", "earliest":
+		return kafka.FirstOffset, nil
+	case "last", "latest":
+		return kafka.LastOffset, nil
+	default:
+		return 0, errors.Errorf("unknown kafka start offset %q", value)
+	}
+}
+
+func saslMechanism(cfg config.Kafka) (sasl.Mechanism, error) {
+	switch strings.ToLower(cfg.SASLMechanism) {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: cfg.SASLUsername, Password: cfg.SASLPassword}, nil
+	case "scram-sha-256":
+		m, err := scram.Mechanism(scram.SHA256, cfg.SASLUsername, cfg.SASLPassword)
+		return m, errors.Wrap(err, "failed to create SCRAM-SHA-256 mechanism")
+	case "scram-sha-512":
+		m, err := scram.Mechanism(scram.SHA512, cfg.SASLUsername, cfg.SASLPassword)
+		return m, errors.Wrap(err, "failed to create SCRAM-SHA-512 mechanism")
+	default:
+		return nil, errors.Errorf("unknown kafka SASL mechanism %q", cfg.SASLMechanism)
+	}
+}
+
+func tlsConfig(cfg config.Kafka) (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read kafka CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("failed to parse kafka CA file")
+		}
+		tc.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load kafka client certificate")
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return tc, nil
+}
+
+// PingKafka проверяет, что доступен хотя бы один брокер
+func PingKafka(ctx context.Context, cfg config.Kafka) error {
+	dialer, err := NewKafkaDialer(cfg)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, broker := range cfg.Brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return conn.Close()
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no kafka brokers configured")
+	}
+	return errors.Wrap(lastErr, "kafka is unreachable")
+}
@@ -0,0 +1,147 @@
+package broker
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrClosed = errors.New("message source closed")
+
+// NewMemoryBroker возвращает брокер в памяти процесса — для тестов
+// консьюмера без Kafka и NATS
+func NewMemoryBroker(size int) *Broker {
+	return &Broker{
+		Name:       Memory,
+		Source:     NewMemorySource(size),
+		DLQ:        NewMemorySink(),
+		Quarantine: NewMemorySink(),
+	}
+}
+
+// MemorySource — очередь на буферизованном канале. Nack возвращает
+// сообщение в конец очереди.
+type MemorySource struct {
+	queue  chan Message
+	done   chan struct{}
+	closed sync.Once
+
+	mu     sync.Mutex
+	offset int64
+	acked  []Message
+	nacked []Message
+}
+
+func NewMemorySource(size int) *MemorySource {
+	return &MemorySource{
+		queue: make(chan Message, size),
+		done:  make(chan struct{}),
+	}
+}
+
+// Send ставит сообщения в очередь, назначая им offset'ы по порядку.
+// Блокируется, пока в очереди нет места.
+func (s *MemorySource) Send(ctx context.Context, msgs ...Message) error {
+	for _, m := range msgs {
+		s.mu.Lock()
+		m.System = Memory
+		m.Offset = s.offset
+		s.offset++
+		if m.Time.IsZero() {
+			m.Time = time.Now()
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.queue <- m:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+func (s *MemorySource) Fetch(ctx context.Context) (Message, error) {
+	select {
+	case m := <-s.queue:
+		s.mu.Lock()
+		m.HighWaterMark = s.offset
+		s.mu.Unlock()
+		return m, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-s.done:
+		return Message{}, ErrClosed
+	}
+}
+
+func (s *MemorySource) Ack(_ context.Context, msgs ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, msgs...)
+	return nil
+}
+
+func (s *MemorySource) Nack(_ context.Context, m Message) error {
+	s.mu.Lock()
+	s.nacked = append(s.nacked, m)
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- m:
+		return nil
+	default:
+		return errors.New("memory queue is full, message dropped")
+	}
+}
+
+func (s *MemorySource) Close() error {
+	s.closed.Do(func() { close(s.done) })
+	return nil
+}
+
+// Acked возвращает подтвержденные сообщения в порядке подтверждения
+func (s *MemorySource) Acked() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.acked)
+}
+
+// Nacked возвращает сообщения, от которых отказался консьюмер
+func (s *MemorySource) Nacked() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.nacked)
+}
+
+// MemorySink запоминает опубликованные сообщения
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Publish(_ context.Context, msgs ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msgs...)
+	return nil
+}
+
+func (s *MemorySink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.messages)
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
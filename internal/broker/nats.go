@@ -0,0 +1,190 @@
+package broker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+)
+
+// HeaderMessageKey — ключ сообщения; в NATS ключей нет, поэтому он
+// передается заголовком
+const HeaderMessageKey = "x-message-key"
+
+func openNATS(ctx context.Context, cfg config.NATS, log *slog.Logger) (*Broker, error) {
+	nc, err := ConnectNATS(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, errors.Wrap(err, "failed to create jetstream context")
+	}
+
+	source, err := NewNATSSource(ctx, js, cfg)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return &Broker{
+		Name:       NATS,
+		Source:     source,
+		DLQ:        NewNATSSink(js, cfg.DLQSubject),
+		Quarantine: NewNATSSink(js, cfg.QuarantineSubject),
+		ping: func(ctx context.Context) error {
+			return errors.Wrap(nc.FlushWithContext(ctx), "nats is unreachable")
+		},
+		close: func() error {
+			nc.Close()
+			return nil
+		},
+	}, nil
+}
+
+// ConnectNATS подключается к серверу и бесконечно переподключается при обрывах
+func ConnectNATS(cfg config.NATS, log *slog.Logger) (*nats.Conn, error) {
+	log = log.With("component", "nats")
+
+	opts := []nats.Option{
+		nats.Name("order-service"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Warn("nats disconnected", "error", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Info("nats reconnected", "url", nc.ConnectedUrlRedacted())
+		}),
+	}
+	if cfg.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	}
+	if cfg.TLSCAFile != "" {
+		opts = append(opts, nats.RootCAs(cfg.TLSCAFile))
+	}
+
+	nc, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to nats")
+	}
+	return nc, nil
+}
+
+// NATSSource читает стрим durable pull-консьюмером с явным подтверждением
+type NATSSource struct {
+	iter     jetstream.MessagesContext
+	nakDelay time.Duration
+}
+
+func NewNATSSource(ctx context.Context, js jetstream.JetStream, cfg config.NATS) (*NATSSource, error) {
+	consumer, err := js.CreateOrUpdateConsumer(ctx, cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: cfg.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create consumer %s on stream %s", cfg.Durable, cfg.Stream)
+	}
+
+	iter, err := consumer.Messages()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe to stream")
+	}
+	return &NATSSource{iter: iter, nakDelay: cfg.NakDelay}, nil
+}
+
+func (s *NATSSource) Fetch(ctx context.Context) (Message, error) {
+	msg, err := s.iter.Next(jetstream.NextContext(ctx))
+	if err != nil {
+		return Message{}, err
+	}
+
+	m := Message{
+		System: NATS,
+		Topic:  msg.Subject(),
+		Value:  msg.Data(),
+		raw:    msg,
+	}
+	for key, values := range msg.Headers() {
+		for _, v := range values {
+			m.Headers = append(m.Headers, Header{Key: key, Value: []byte(v)})
+		}
+	}
+	if key := msg.Headers().Get(HeaderMessageKey); key != "" {
+		m.Key = []byte(key)
+	}
+	if meta, err := msg.Metadata(); err == nil {
+		m.Offset = int64(meta.Sequence.Stream)
+		m.HighWaterMark = m.Offset + int64(meta.NumPending) + 1
+		m.Time = meta.Timestamp
+	}
+	return m, nil
+}
+
+// Ack ждет подтверждения от сервера, чтобы сообщения не пришли повторно
+func (s *NATSSource) Ack(ctx context.Context, msgs ...Message) error {
+	for _, m := range msgs {
+		msg, ok := m.raw.(jetstream.Msg)
+		if !ok {
+			return errors.New("message was not fetched from nats")
+		}
+		if err := msg.DoubleAck(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *NATSSource) Nack(_ context.Context, m Message) error {
+	msg, ok := m.raw.(jetstream.Msg)
+	if !ok {
+		return errors.New("message was not fetched from nats")
+	}
+	return msg.NakWithDelay(s.nakDelay)
+}
+
+func (s *NATSSource) Close() error {
+	s.iter.Stop()
+	return nil
+}
+
+// NATSSink публикует в subject через JetStream, дожидаясь подтверждения
+// записи в стрим. Подключение принадлежит Broker.
+type NATSSink struct {
+	js      jetstream.JetStream
+	subject string
+}
+
+func NewNATSSink(js jetstream.JetStream, subject string) *NATSSink {
+	return &NATSSink{js: js, subject: subject}
+}
+
+func (s *NATSSink) Publish(ctx context.Context, msgs ...Message) error {
+	for _, m := range msgs {
+		msg := nats.NewMsg(s.subject)
+		msg.Data = m.Value
+		for _, h := range m.Headers {
+			msg.Header.Add(h.Key, string(h.Value))
+		}
+		if len(m.Key) > 0 {
+			msg.Header.Set(HeaderMessageKey, string(m.Key))
+		}
+		if _, err := s.js.PublishMsg(ctx, msg); err != nil {
+			return errors.Wrapf(err, "failed to publish to %s", s.subject)
+		}
+	}
+	return nil
+}
+
+func (s *NATSSink) Close() error {
+	return nil
+}
@@ -1,57 +1,613 @@
 package cache
 
 import (
-	"fmt"
+	"cmp"
+	"container/list"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/yakovleviga/brokerService/internal/config"
 	"github.com/yakovleviga/brokerService/internal/db"
 )
 
+type entry struct {
+	order     db.FullOrder
+	size      int64
+	expiresAt time.Time
+}
+
+type Stats struct {
+	Entries         int    `json:"entries"`
+	Bytes           int64  `json:"bytes"`
+	MaxEntries      int    `json:"max_entries"`
+	MaxBytes        int64  `json:"max_bytes"`
+	Hits            uint64 `json:"hits"`
+	Misses          uint64 `json:"misses"`
+	Evictions       uint64 `json:"evictions"`
+	Expirations     uint64 `json:"expirations"`
+	NegativeEntries int    `json:"negative_entries"`
+	NegativeHits    uint64 `json:"negative_hits"`
+}
+
+// LookupKind — ключ, по которому заказ (или список заказов) ищут в БД
+type LookupKind string
+
+const (
+	ByOrderUID    LookupKind = "order_uid"
+	ByTrackNumber LookupKind = "track_number"
+	ByRid         LookupKind = "rid"
+	ByCustomerID  LookupKind = "customer_id"
+	ByChrtID      LookupKind = "chrt_id"
+)
+
+type lookupKey struct {
+	kind  LookupKind
+	value string
+}
+
+// pendingLookup — незавершенные поиски ключа в БД. found поднимается, если
+// за это время заказ с этим ключом пришел из консьюмера, removed — если
+// заказ с этим ключом вытеснен: в обоих случаях ответ БД устарел для кэша.
+type pendingLookup struct {
+	refs    int
+	found   bool
+	removed bool
+}
+
+// Cache — LRU-кэш заказов с ограничением по числу записей и/или по
+// приблизительному объему в байтах и необязательным TTL записи.
+// Нулевые лимиты означают «без ограничения».
 type Cache struct {
-	mu     sync.RWMutex
-	orders map[string]db.FullOrder
+	mu     sync.Mutex
+	orders map[string]*list.Element
+	lru    *list.List // front — самый свежий
+
+	// Вторичные индексы: значение -> order_uid
+	byTrack map[string]string
+	byRid   map[string]string
+
+	// Индексы покупателя и товара: значение -> order_uid закэшированных
+	// заказов. Список отдается из кэша, только если он полный (complete):
+	// загружен из БД через Lookup.Complete и с тех пор ни один заказ из него
+	// не вытеснен. Новые заказы попадают в индекс через Set.
+	byCustomer       map[string]map[string]struct{}
+	byChrtID         map[int64]map[string]struct{}
+	customerComplete map[string]struct{}
+	chrtIDComplete   map[int64]struct{}
+
+	// Негативный кэш: ключ -> момент, до которого помним «не найден»
+	negative    map[lookupKey]time.Time
+	negativeTTL time.Duration
+	negativeMax int
+	pending     map[lookupKey]*pendingLookup
+
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	bytes      int64
+
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+	negHits     uint64
+
+	now func() time.Time
 }
 
-func NewCache() *Cache {
+func NewCache(cfg config.Cache) *Cache {
 	return &Cache{
-		orders: make(map[string]db.FullOrder),
+		orders:           make(map[string]*list.Element),
+		lru:              list.New(),
+		byTrack:          make(map[string]string),
+		byRid:            make(map[string]string),
+		byCustomer:       make(map[string]map[string]struct{}),
+		byChrtID:         make(map[int64]map[string]struct{}),
+		customerComplete: make(map[string]struct{}),
+		chrtIDComplete:   make(map[int64]struct{}),
+		negative:         make(map[lookupKey]time.Time),
+		pending:          make(map[lookupKey]*pendingLookup),
+		negativeTTL:      cfg.NegativeTTL,
+		negativeMax:      cfg.NegativeMaxEntries,
+		maxEntries:       cfg.MaxEntries,
+		maxBytes:         cfg.MaxBytes,
+		ttl:              cfg.TTL,
+		now:              time.Now,
 	}
 }
 
 func (c *Cache) Set(order db.FullOrder) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.orders[order.OrderUID] = order
+	c.set(order)
+}
+
+// Warm добавляет заказ при прогреве. Прогрев идет от новых заказов к старым,
+// поэтому заказ встает в конец LRU, как самый старый, и не вытесняет уже
+// загруженные. Закэшированный заказ не перезаписывается: данные из
+// консьюмера свежее. Возвращает false, когда заказ уже не помещается в кэш —
+// прогревать дальше незачем.
+func (c *Cache) Warm(order db.FullOrder) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.orders[order.OrderUID]; ok {
+		if !c.expired(el.Value.(*entry)) {
+			return true
+		}
+		c.removeElement(el)
+	}
+
+	e := &entry{order: order, size: sizeOf(order)}
+	if c.ttl > 0 {
+		e.expiresAt = c.now().Add(c.ttl)
+	}
+	el := c.lru.PushBack(e)
+	c.orders[order.OrderUID] = el
+	c.bytes += e.size
+	c.index(order)
+	c.forgetNotFound(order)
+
+	if c.overLimit() {
+		c.removeElement(el)
+		return false
+	}
+	return true
+}
+
+func (c *Cache) MaxEntries() int {
+	return c.maxEntries
+}
+
+// set вызывается под мьютексом
+func (c *Cache) set(order db.FullOrder) {
+	e := &entry{order: order, size: sizeOf(order)}
+	if c.ttl > 0 {
+		e.expiresAt = c.now().Add(c.ttl)
+	}
+
+	if el, ok := c.orders[order.OrderUID]; ok {
+		old := el.Value.(*entry)
+		c.unindex(old.order)
+		c.bytes += e.size - old.size
+		el.Value = e
+		c.lru.MoveToFront(el)
+	} else {
+		c.orders[order.OrderUID] = c.lru.PushFront(e)
+		c.bytes += e.size
+	}
+	c.index(order)
+	c.forgetNotFound(order)
+
+	c.evict()
+}
+
+// Lookup — поиск ключа в БД после промаха кэша. Создается до запроса в БД
+// и завершается End.
+type Lookup struct {
+	c       *Cache
+	key     lookupKey
+	pending *pendingLookup
+}
+
+// BeginLookup регистрирует поиск ключа в БД, чтобы заказ, пришедший из
+// консьюмера во время поиска, не оказался запомнен как «не найден»
+func (c *Cache) BeginLookup(kind LookupKind, value string) *Lookup {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := lookupKey{kind, value}
+	p, ok := c.pending[key]
+	if !ok {
+		p = &pendingLookup{}
+		c.pending[key] = p
+	}
+	p.refs++
+	return &Lookup{c: c, key: key, pending: p}
+}
+
+// NotFound запоминает, что заказа с ключом нет в БД. Запись не создается,
+// если заказ появился в кэше или пришел через Set/ForgetNotFound, пока шел
+// поиск. Снимается по истечении CACHE_NEGATIVE_TTL или с приходом заказа.
+func (l *Lookup) NotFound() {
+	c := l.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.negativeTTL <= 0 || l.pending == nil || l.pending.found || c.has(l.key.kind, l.key.value) {
+		// Заказ успел прийти, пока мы ходили в БД
+		return
+	}
+
+	now := c.now()
+	if c.negativeMax > 0 && len(c.negative) >= c.negativeMax {
+		for key, until := range c.negative {
+			if now.After(until) {
+				delete(c.negative, key)
+			}
+		}
+		// Все записи свежие: вытесняем произвольную
+		for key := range c.negative {
+			if len(c.negative) < c.negativeMax {
+				break
+			}
+			delete(c.negative, key)
+		}
+	}
+	c.negative[l.key] = now.Add(c.negativeTTL)
+}
+
+// End завершает поиск; повторный вызов ничего не делает
+func (l *Lookup) End() {
+	c := l.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if l.pending == nil {
+		return
+	}
+	l.pending.refs--
+	if l.pending.refs == 0 {
+		delete(c.pending, l.key)
+	}
+	l.pending = nil
+}
+
+// Complete кладет в кэш заказы, найденные по ключу покупателя или товара,
+// и отмечает список полным, если за время поиска ни один заказ с этим ключом
+// не был вытеснен. Закэшированные заказы не перезаписываются: они свежее
+// ответа БД. Вызывается, только если БД вернула весь список, без обрезки.
+func (l *Lookup) Complete(orders []db.FullOrder) {
+	c := l.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range orders {
+		if el, ok := c.orders[o.OrderUID]; !ok || c.expired(el.Value.(*entry)) {
+			c.set(o)
+		}
+	}
+	if l.pending == nil || l.pending.removed || len(orders) == 0 {
+		return
+	}
+	// Заказы могли вытеснить друг друга, если кэш меньше списка
+	for _, o := range orders {
+		if _, ok := c.orders[o.OrderUID]; !ok {
+			return
+		}
+	}
+
+	switch l.key.kind {
+	case ByCustomerID:
+		if _, ok := c.byCustomer[l.key.value]; ok {
+			c.customerComplete[l.key.value] = struct{}{}
+		}
+	case ByChrtID:
+		chrtID, err := strconv.ParseInt(l.key.value, 10, 64)
+		if _, ok := c.byChrtID[chrtID]; ok && err == nil {
+			c.chrtIDComplete[chrtID] = struct{}{}
+		}
+	}
+}
+
+// IsNotFound сообщает, есть ли свежая негативная запись для ключа
+func (c *Cache) IsNotFound(kind LookupKind, value string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := lookupKey{kind, value}
+	until, ok := c.negative[key]
+	if !ok {
+		return false
+	}
+	if c.now().After(until) {
+		delete(c.negative, key)
+		return false
+	}
+	c.negHits++
+	return true
+}
+
+// ForgetNotFound снимает негативные записи для ключей заказа, не трогая
+// сам кэш. Set делает это автоматически.
+func (c *Cache) ForgetNotFound(order db.FullOrder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forgetNotFound(order)
+}
+
+// has сообщает, есть ли в кэше непросроченный заказ с таким ключом.
+// Вызывается под мьютексом.
+func (c *Cache) has(kind LookupKind, value string) bool {
+	orderUID := value
+	switch kind {
+	case ByTrackNumber:
+		orderUID = c.byTrack[value]
+	case ByRid:
+		orderUID = c.byRid[value]
+	}
+	el, ok := c.orders[orderUID]
+	return ok && !c.expired(el.Value.(*entry))
+}
+
+// forgetNotFound снимает негативные записи для всех ключей заказа и
+// отмечает идущие по ним поиски устаревшими. Вызывается под мьютексом.
+func (c *Cache) forgetNotFound(o db.FullOrder) {
+	if len(c.negative) == 0 && len(c.pending) == 0 {
+		return
+	}
+	c.forgetKey(lookupKey{ByOrderUID, o.OrderUID})
+	c.forgetKey(lookupKey{ByTrackNumber, o.TrackNumber})
+	for _, it := range o.Items {
+		c.forgetKey(lookupKey{ByRid, it.Rid})
+	}
+}
+
+func (c *Cache) forgetKey(key lookupKey) {
+	delete(c.negative, key)
+	if p, ok := c.pending[key]; ok {
+		p.found = true
+	}
 }
 
 func (c *Cache) Get(orderUID string) (db.FullOrder, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	order, exists := c.orders[orderUID]
-	return order, exists
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(orderUID)
+}
+
+func (c *Cache) GetByTrackNumber(trackNumber string) (db.FullOrder, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orderUID, ok := c.byTrack[trackNumber]
+	if !ok {
+		c.misses++
+		return db.FullOrder{}, false
+	}
+	return c.get(orderUID)
+}
+
+func (c *Cache) GetByRid(rid string) (db.FullOrder, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orderUID, ok := c.byRid[rid]
+	if !ok {
+		c.misses++
+		return db.FullOrder{}, false
+	}
+	return c.get(orderUID)
+}
+
+// GetByCustomerID возвращает заказы покупателя, новые первыми, если их
+// список в кэше полный; иначе список нужно загрузить из БД
+func (c *Cache) GetByCustomerID(customerID string) ([]db.FullOrder, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	uids, ok := c.byCustomer[customerID]
+	if _, complete := c.customerComplete[customerID]; !complete || !ok {
+		// Флаг без заказов остается, если заказ сменил покупателя
+		delete(c.customerComplete, customerID)
+		c.misses++
+		return nil, false
+	}
+	return c.getMany(uids)
+}
+
+// GetByChrtID возвращает заказы с товаром chrtID, новые первыми, если их
+// список в кэше полный
+func (c *Cache) GetByChrtID(chrtID int64) ([]db.FullOrder, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	uids, ok := c.byChrtID[chrtID]
+	if _, complete := c.chrtIDComplete[chrtID]; !complete || !ok {
+		delete(c.chrtIDComplete, chrtID)
+		c.misses++
+		return nil, false
+	}
+	return c.getMany(uids)
+}
+
+// getMany вызывается под мьютексом. Истекший заказ делает список неполным.
+func (c *Cache) getMany(uids map[string]struct{}) ([]db.FullOrder, bool) {
+	orders := make([]db.FullOrder, 0, len(uids))
+	for uid := range uids {
+		order, ok := c.get(uid)
+		if !ok {
+			return nil, false
+		}
+		orders = append(orders, order)
+	}
+	slices.SortFunc(orders, func(a, b db.FullOrder) int {
+		return cmp.Or(b.DateCreated.Compare(a.DateCreated), cmp.Compare(a.OrderUID, b.OrderUID))
+	})
+	return orders, true
+}
+
+// get вызывается под мьютексом
+func (c *Cache) get(orderUID string) (db.FullOrder, bool) {
+	el, ok := c.orders[orderUID]
+	if !ok {
+		c.misses++
+		return db.FullOrder{}, false
+	}
+
+	e := el.Value.(*entry)
+	if c.expired(e) {
+		c.removeElement(el)
+		c.expirations++
+		c.misses++
+		return db.FullOrder{}, false
+	}
+
+	c.lru.MoveToFront(el)
+	c.hits++
+	return e.order, true
 }
 
 func (c *Cache) Delete(orderUID string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	delete(c.orders, orderUID)
+
+	if el, ok := c.orders[orderUID]; ok {
+		c.removeElement(el)
+	}
 }
 
 func (c *Cache) GetAll() []db.FullOrder {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	all := make([]db.FullOrder, 0, len(c.orders))
-	for _, order := range c.orders {
-		all = append(all, order)
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry)
+		if !c.expired(e) {
+			all = append(all, e.order)
+		}
 	}
 	return all
 }
 
-func PrintCache(c *Cache) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.orders)
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Entries:         len(c.orders),
+		Bytes:           c.bytes,
+		MaxEntries:      c.maxEntries,
+		MaxBytes:        c.maxBytes,
+		Hits:            c.hits,
+		Misses:          c.misses,
+		Evictions:       c.evictions,
+		Expirations:     c.expirations,
+		NegativeEntries: len(c.negative),
+		NegativeHits:    c.negHits,
+	}
+}
+
+// evict вытесняет самые старые записи, пока кэш не уложится в лимиты.
+// Вызывается под мьютексом.
+func (c *Cache) evict() {
+	for c.lru.Len() > 0 && c.overLimit() {
+		c.removeElement(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *Cache) overLimit() bool {
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes > c.maxBytes
+}
+
+func (c *Cache) expired(e *entry) bool {
+	return !e.expiresAt.IsZero() && c.now().After(e.expiresAt)
+}
+
+// removeElement убирает заказ из кэша: списки с ним становятся неполными
+func (c *Cache) removeElement(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.orders, e.order.OrderUID)
+	c.unindex(e.order)
+	c.bytes -= e.size
+
+	o := e.order
+	delete(c.customerComplete, o.CustomerID)
+	c.markRemoved(lookupKey{ByCustomerID, o.CustomerID})
+	for _, it := range o.Items {
+		delete(c.chrtIDComplete, it.ChrtID)
+		c.markRemoved(lookupKey{ByChrtID, strconv.FormatInt(it.ChrtID, 10)})
+	}
+}
 
-	for k, v := range c.orders {
-		fmt.Printf("OrderUID: %s, Order: %+v\n", k, v)
+func (c *Cache) markRemoved(key lookupKey) {
+	if p, ok := c.pending[key]; ok {
+		p.removed = true
+	}
+}
+
+func (c *Cache) index(o db.FullOrder) {
+	if o.TrackNumber != "" {
+		c.byTrack[o.TrackNumber] = o.OrderUID
+	}
+	if o.CustomerID != "" {
+		addToSet(c.byCustomer, o.CustomerID, o.OrderUID)
+	}
+	for _, it := range o.Items {
+		if it.Rid != "" {
+			c.byRid[it.Rid] = o.OrderUID
+		}
+		addToSet(c.byChrtID, it.ChrtID, o.OrderUID)
+	}
+}
+
+func (c *Cache) unindex(o db.FullOrder) {
+	// Удаляем только ссылки на этот заказ: другой заказ мог перезаписать ключ
+	if c.byTrack[o.TrackNumber] == o.OrderUID {
+		delete(c.byTrack, o.TrackNumber)
+	}
+	removeFromSet(c.byCustomer, o.CustomerID, o.OrderUID)
+	for _, it := range o.Items {
+		if c.byRid[it.Rid] == o.OrderUID {
+			delete(c.byRid, it.Rid)
+		}
+		removeFromSet(c.byChrtID, it.ChrtID, o.OrderUID)
+	}
+}
+
+func addToSet[K comparable](index map[K]map[string]struct{}, key K, orderUID string) {
+	set, ok := index[key]
+	if !ok {
+		set = make(map[string]struct{})
+		index[key] = set
+	}
+	set[orderUID] = struct{}{}
+}
+
+func removeFromSet[K comparable](index map[K]map[string]struct{}, key K, orderUID string) {
+	set, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(set, orderUID)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
+
+// sizeOf приблизительно оценивает объем заказа в памяти
+func sizeOf(o db.FullOrder) int64 {
+	const (
+		orderOverhead = 256
+		itemOverhead  = 128
+	)
+
+	size := int64(orderOverhead)
+	for _, s := range []string{
+		o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature, o.CustomerID,
+		o.DeliveryService, o.ShardKey, o.OofShard, o.Status,
+		o.Delivery.Name, o.Delivery.Phone, o.Delivery.Zip, o.Delivery.City,
+		o.Delivery.Address, o.Delivery.Region, o.Delivery.Email,
+		o.Payment.Transaction, o.Payment.RequestID, o.Payment.Currency,
+		o.Payment.Provider, o.Payment.Bank,
+	} {
+		size += int64(len(s))
+	}
+	for _, it := range o.Items {
+		size += itemOverhead + int64(len(it.TrackNumber)+len(it.Rid)+len(it.Name)+len(it.Size)+len(it.Brand))
 	}
+	return size
 }
@@ -0,0 +1,354 @@
+package cache
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testOrder(uid, customerID string, created int, chrtIDs ...int64) db.FullOrder {
+	o := db.FullOrder{
+		OrderUID:    uid,
+		TrackNumber: "TRACK-" + uid,
+		CustomerID:  customerID,
+		DateCreated: epoch.Add(time.Duration(created) * time.Hour),
+	}
+	for _, id := range chrtIDs {
+		o.Items = append(o.Items, db.Item{ChrtID: id, Rid: uid + "-rid"})
+	}
+	return o
+}
+
+func uids(orders []db.FullOrder) []string {
+	out := make([]string, len(orders))
+	for i, o := range orders {
+		out[i] = o.OrderUID
+	}
+	return out
+}
+
+func TestCustomerIndexServesOnlyCompleteLists(t *testing.T) {
+	c := NewCache(config.Cache{})
+
+	// Заказ, пришедший из консьюмера, сам по себе список не делает полным
+	c.Set(testOrder("a", "cust", 1, 10))
+	if _, ok := c.GetByCustomerID("cust"); ok {
+		t.Fatal("list served before it was loaded from the database")
+	}
+
+	lookup := c.BeginLookup(ByCustomerID, "cust")
+	lookup.Complete([]db.FullOrder{testOrder("a", "cust", 1, 10), testOrder("b", "cust", 2, 10)})
+	lookup.End()
+
+	orders, ok := c.GetByCustomerID("cust")
+	if !ok {
+		t.Fatal("complete list not served from cache")
+	}
+	if got, want := uids(orders), []string{"b", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("orders %v, want newest first %v", got, want)
+	}
+
+	// Новый заказ покупателя попадает в полный список
+	c.Set(testOrder("c", "cust", 3, 20))
+	orders, _ = c.GetByCustomerID("cust")
+	if got, want := uids(orders), []string{"c", "b", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("orders %v, want %v", got, want)
+	}
+
+	// Вытеснение одного заказа делает список неполным
+	c.Delete("a")
+	if _, ok := c.GetByCustomerID("cust"); ok {
+		t.Fatal("list served after one of its orders was removed")
+	}
+	if _, ok := c.GetByChrtID(10); ok {
+		t.Fatal("chrt_id list served after one of its orders was removed")
+	}
+}
+
+func TestLookupCompleteSkipsListsChangedDuringLookup(t *testing.T) {
+	c := NewCache(config.Cache{})
+	c.Set(testOrder("a", "cust", 1, 10))
+
+	lookup := c.BeginLookup(ByChrtID, "10")
+	// Пока шел запрос в БД, заказ с этим товаром вытеснили
+	c.Delete("a")
+	lookup.Complete([]db.FullOrder{testOrder("b", "cust", 2, 10)})
+	lookup.End()
+
+	if _, ok := c.GetByChrtID(10); ok {
+		t.Fatal("list marked complete although an order was removed during the lookup")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Fatal("loaded order not cached")
+	}
+}
+
+func TestCustomerIndexExpiredOrder(t *testing.T) {
+	now := epoch
+	c := NewCache(config.Cache{TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	lookup := c.BeginLookup(ByCustomerID, "cust")
+	lookup.Complete([]db.FullOrder{testOrder("a", "cust", 1), testOrder("b", "cust", 2)})
+	lookup.End()
+	if _, ok := c.GetByCustomerID("cust"); !ok {
+		t.Fatal("complete list not served")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.GetByCustomerID("cust"); ok {
+		t.Fatal("list with expired orders served from cache")
+	}
+}
+
+func TestWarmKeepsNewestOrders(t *testing.T) {
+	order := testOrder("o0", "cust", 0)
+	c := NewCache(config.Cache{MaxBytes: 3 * sizeOf(order)})
+
+	// Прогрев идет от новых заказов к старым
+	var warmed []string
+	for i := 5; i >= 0; i-- {
+		o := testOrder("o"+strconv.Itoa(i), "cust", i)
+		if !c.Warm(o) {
+			break
+		}
+		warmed = append(warmed, o.OrderUID)
+	}
+
+	if want := []string{"o5", "o4", "o3"}; !slices.Equal(warmed, want) {
+		t.Fatalf("warmed %v, want %v", warmed, want)
+	}
+	if got := uids(c.GetAll()); !slices.Equal(got, []string{"o5", "o4", "o3"}) {
+		t.Fatalf("cache holds %v, want the newest orders", got)
+	}
+	if _, ok := c.Get("o2"); ok {
+		t.Fatal("order that did not fit stayed in cache")
+	}
+	if st := c.Stats(); st.Evictions != 0 {
+		t.Fatalf("warm-up evicted %d orders", st.Evictions)
+	}
+
+	// Заказ из консьюмера новее прогретых и вытесняет самый старый из них
+	c.Set(testOrder("o9", "cust", 9))
+	if _, ok := c.Get("o3"); ok {
+		t.Fatal("oldest warmed order was not evicted")
+	}
+	if _, ok := c.Get("o5"); !ok {
+		t.Fatal("newest warmed order was evicted")
+	}
+}
+
+// indexedUIDs собирает order_uid, на которые ссылаются вторичные индексы
+func indexedUIDs(c *Cache) map[string]bool {
+	out := make(map[string]bool)
+	for _, uid := range c.byTrack {
+		out[uid] = true
+	}
+	for _, uid := range c.byRid {
+		out[uid] = true
+	}
+	for _, set := range c.byCustomer {
+		for uid := range set {
+			out[uid] = true
+		}
+	}
+	for _, set := range c.byChrtID {
+		for uid := range set {
+			out[uid] = true
+		}
+	}
+	return out
+}
+
+// checkConsistent проверяет, что индексы и счетчик байт соответствуют
+// ровно заказам из want
+func checkConsistent(t *testing.T, c *Cache, want ...string) {
+	t.Helper()
+
+	var got []string
+	var bytes int64
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry)
+		got = append(got, e.order.OrderUID)
+		bytes += e.size
+	}
+	slices.Sort(got)
+	want = slices.Sorted(slices.Values(want))
+	if !slices.Equal(got, want) {
+		t.Fatalf("cache holds %v, want %v", got, want)
+	}
+	if len(c.orders) != len(want) {
+		t.Fatalf("orders map has %d entries, want %d", len(c.orders), len(want))
+	}
+	if c.bytes != bytes {
+		t.Fatalf("bytes counter %d, want %d", c.bytes, bytes)
+	}
+
+	indexed := indexedUIDs(c)
+	for uid := range indexed {
+		if !slices.Contains(want, uid) {
+			t.Fatalf("index still references removed order %s", uid)
+		}
+	}
+	for _, uid := range want {
+		if !indexed[uid] {
+			t.Fatalf("order %s is not indexed", uid)
+		}
+	}
+}
+
+func TestEviction(t *testing.T) {
+	size := sizeOf(testOrder("a", "cust-a", 0, 1))
+
+	tests := []struct {
+		name string
+		cfg  config.Cache
+		// "+uid" — Set, "uid" — Get
+		ops           []string
+		wantKept      []string
+		wantEvictions uint64
+	}{
+		{
+			name:          "max entries",
+			cfg:           config.Cache{MaxEntries: 2},
+			ops:           []string{"+a", "+b", "+c"},
+			wantKept:      []string{"b", "c"},
+			wantEvictions: 1,
+		},
+		{
+			name:          "max entries keeps recently read",
+			cfg:           config.Cache{MaxEntries: 2},
+			ops:           []string{"+a", "+b", "a", "+c"},
+			wantKept:      []string{"a", "c"},
+			wantEvictions: 1,
+		},
+		{
+			name:          "max bytes",
+			cfg:           config.Cache{MaxBytes: 2 * size},
+			ops:           []string{"+a", "+b", "+c", "+d"},
+			wantKept:      []string{"c", "d"},
+			wantEvictions: 2,
+		},
+		{
+			name:          "update does not evict",
+			cfg:           config.Cache{MaxEntries: 2},
+			ops:           []string{"+a", "+b", "+a", "+b"},
+			wantKept:      []string{"a", "b"},
+			wantEvictions: 0,
+		},
+		{
+			name:     "no limits",
+			ops:      []string{"+a", "+b", "+c"},
+			wantKept: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(tt.cfg)
+			for i, op := range tt.ops {
+				if uid, ok := strings.CutPrefix(op, "+"); ok {
+					c.Set(testOrder(uid, "cust-"+uid, i, int64(i+1)))
+					continue
+				}
+				if _, ok := c.Get(op); !ok {
+					t.Fatalf("op %d: order %s not cached", i, op)
+				}
+			}
+
+			checkConsistent(t, c, tt.wantKept...)
+			if st := c.Stats(); st.Evictions != tt.wantEvictions {
+				t.Fatalf("evictions %d, want %d", st.Evictions, tt.wantEvictions)
+			}
+			for _, uid := range tt.wantKept {
+				if _, ok := c.GetByTrackNumber("TRACK-" + uid); !ok {
+					t.Errorf("order %s not found by track number", uid)
+				}
+				if _, ok := c.GetByRid(uid + "-rid"); !ok {
+					t.Errorf("order %s not found by rid", uid)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexCleanup(t *testing.T) {
+	c := NewCache(config.Cache{})
+	c.Set(testOrder("a", "cust", 1, 10, 20))
+	c.Set(testOrder("b", "cust", 2, 10))
+
+	// Обновление убирает из индексов старые значения заказа
+	moved := testOrder("a", "other", 1, 30)
+	moved.TrackNumber = "TRACK-moved"
+	moved.Items[0].Rid = "moved-rid"
+	c.Set(moved)
+
+	if _, ok := c.GetByTrackNumber("TRACK-a"); ok {
+		t.Error("old track number still indexed")
+	}
+	if _, ok := c.GetByRid("a-rid"); ok {
+		t.Error("old rid still indexed")
+	}
+	if _, ok := c.byChrtID[20]; ok {
+		t.Error("old chrt_id still indexed")
+	}
+	if got, want := slices.Sorted(maps.Keys(c.byChrtID[10])), []string{"b"}; !slices.Equal(got, want) {
+		t.Errorf("chrt_id 10 references %v, want %v", got, want)
+	}
+	if got, want := slices.Sorted(maps.Keys(c.byCustomer["cust"])), []string{"b"}; !slices.Equal(got, want) {
+		t.Errorf("customer references %v, want %v", got, want)
+	}
+	checkConsistent(t, c, "a", "b")
+
+	// Чужой заказ с тем же track_number перезаписывает ключ, и удаление
+	// прежнего владельца его не трогает
+	c.Set(testOrder("c", "cust", 3))
+	dup := testOrder("d", "cust", 4)
+	dup.TrackNumber = "TRACK-c"
+	c.Set(dup)
+	c.Delete("c")
+	if o, ok := c.GetByTrackNumber("TRACK-c"); !ok || o.OrderUID != "d" {
+		t.Errorf("track number lost after deleting its previous owner: %+v, %v", o.OrderUID, ok)
+	}
+
+	c.Delete("a")
+	c.Delete("b")
+	c.Delete("d")
+	checkConsistent(t, c)
+	if len(c.byCustomer) != 0 || len(c.byChrtID) != 0 {
+		t.Fatalf("empty index sets left: customers %v, chrt_ids %v", c.byCustomer, c.byChrtID)
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	now := epoch
+	c := NewCache(config.Cache{TTL: time.Minute})
+	c.now = func() time.Time { return now }
+
+	c.Set(testOrder("a", "cust", 1, 10))
+	now = now.Add(30 * time.Second)
+	c.Set(testOrder("b", "cust", 2, 10))
+	now = now.Add(45 * time.Second)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expired order served")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Fatal("live order not served")
+	}
+	if st := c.Stats(); st.Expirations != 1 || st.Evictions != 0 {
+		t.Fatalf("expirations %d, evictions %d; want 1, 0", st.Expirations, st.Evictions)
+	}
+	if got := uids(c.GetAll()); !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("GetAll returned %v, want [b]", got)
+	}
+	checkConsistent(t, c, "b")
+}
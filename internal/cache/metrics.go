@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	entriesDesc     = prometheus.NewDesc("orders_cache_entries", "Orders currently cached.", nil, nil)
+	bytesDesc       = prometheus.NewDesc("orders_cache_bytes", "Approximate cache size in bytes.", nil, nil)
+	hitsDesc        = prometheus.NewDesc("orders_cache_hits_total", "Cache hits.", nil, nil)
+	missesDesc      = prometheus.NewDesc("orders_cache_misses_total", "Cache misses.", nil, nil)
+	evictionsDesc   = prometheus.NewDesc("orders_cache_evictions_total", "Entries evicted by size limits.", nil, nil)
+	expirationsDesc = prometheus.NewDesc("orders_cache_expirations_total", "Entries dropped after TTL.", nil, nil)
+	negEntriesDesc  = prometheus.NewDesc("orders_cache_negative_entries", "Remembered not-found lookups.", nil, nil)
+	negHitsDesc     = prometheus.NewDesc("orders_cache_negative_hits_total", "Lookups answered from the negative cache.", nil, nil)
+)
+
+// Collector снимает Stats при каждом scrape
+func (c *Cache) Collector() prometheus.Collector {
+	return collector{c}
+}
+
+type collector struct {
+	cache *Cache
+}
+
+func (collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- entriesDesc
+	ch <- bytesDesc
+	ch <- hitsDesc
+	ch <- missesDesc
+	ch <- evictionsDesc
+	ch <- expirationsDesc
+	ch <- negEntriesDesc
+	ch <- negHitsDesc
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(entriesDesc, prometheus.GaugeValue, float64(s.Entries))
+	ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.GaugeValue, float64(s.Bytes))
+	ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(missesDesc, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(expirationsDesc, prometheus.CounterValue, float64(s.Expirations))
+	ch <- prometheus.MustNewConstMetric(negEntriesDesc, prometheus.GaugeValue, float64(s.NegativeEntries))
+	ch <- prometheus.MustNewConstMetric(negHitsDesc, prometheus.CounterValue, float64(s.NegativeHits))
+}
@@ -1,19 +1,67 @@
 package config
 
 import (
+	"os"
 	"time"
 )
 
+// deprecatedEnv — устаревшее имя переменной окружения -> новое
+var deprecatedEnv = map[string]string{
+	"KAFKA_RETRY_MAX_ATTEMPTS":    "CONSUMER_RETRY_MAX_ATTEMPTS",
+	"KAFKA_RETRY_INITIAL_BACKOFF": "CONSUMER_RETRY_INITIAL_BACKOFF",
+	"KAFKA_RETRY_MAX_BACKOFF":     "CONSUMER_RETRY_MAX_BACKOFF",
+	"KAFKA_RETRY_MULTIPLIER":      "CONSUMER_RETRY_MULTIPLIER",
+	"KAFKA_RETRY_JITTER":          "CONSUMER_RETRY_JITTER",
+}
+
+// ApplyDeprecatedEnv переносит значения устаревших переменных под новые
+// имена, если новые не заданы. Вызывается до envconfig.Process; возвращает
+// заданные устаревшие переменные (старое имя -> новое), чтобы о них предупредить.
+func ApplyDeprecatedEnv() map[string]string {
+	used := make(map[string]string)
+	for old, name := range deprecatedEnv {
+		value, ok := os.LookupEnv(old)
+		if !ok {
+			continue
+		}
+		used[old] = name
+		if _, ok := os.LookupEnv(name); !ok {
+			_ = os.Setenv(name, value)
+		}
+	}
+	return used
+}
+
 type AppConfig struct {
-	LogLevel   string `envconfig:"LOG_LEVEL" default:"info"`
-	Rest       Rest
-	PostgreSQL PostgreSQL
+	LogLevel        string        `envconfig:"LOG_LEVEL" default:"info"`
+	LogFormat       string        `envconfig:"LOG_FORMAT" default:"json"`
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	Broker          string        `envconfig:"BROKER" default:"kafka"` // kafka | nats
+	Rest            Rest
+	PostgreSQL      PostgreSQL
+	Kafka           Kafka
+	NATS            NATS
+	Consumer        Consumer
+	Validation      Validation
+	Cache           Cache
+	Warmup          Warmup
+	Health          Health
+	Tracing         Tracing
+	Redaction       Redaction
+	Auth            Auth
+	RateLimit       RateLimit
+	Outbox          Outbox
 }
 
 type Rest struct {
 	ListenAddress string        `envconfig:"PORT" required:"true"`
 	WriteTimeout  time.Duration `envconfig:"WRITE_TIMEOUT" default:"15s"`
 	ServerName    string        `envconfig:"SERVER_NAME" required:"true"`
+	// Через запятую; * разрешает любой origin
+	CORSAllowOrigins string `envconfig:"CORS_ALLOW_ORIGINS" default:"http://localhost:8080"`
+	// Отдавать заказы в прежней форме (PascalCase) по умолчанию; в запросе
+	// форму можно выбрать через ?shape=legacy|canonical
+	LegacyShape bool `envconfig:"API_LEGACY_SHAPE" default:"false"`
 }
 
 type PostgreSQL struct {
@@ -23,7 +71,141 @@ type PostgreSQL struct {
 	User                string        `envconfig:"DB_USER" required:"true"`
 	Password            string        `envconfig:"DB_PASSWORD" required:"true"`
 	SSLMode             string        `envconfig:"DB_SSL_MODE" default:"disable"`
-	PoolMaxConns        int           `envconfig:"DB_POOL_MAX_CONNS" default:"5"`
+	PoolMaxConns        int           `envconfig:"DB_POOL_MAX_CONNS" default:"10"`
 	PoolMaxConnLifetime time.Duration `envconfig:"DB_POOL_MAX_CONN_LIFETIME" default:"180s"`
 	PoolMaxConnIdleTime time.Duration `envconfig:"DB_POOL_MAX_CONN_IDLE_TIME" default:"100s"`
 }
+
+type Kafka struct {
+	Brokers     []string      `envconfig:"KAFKA_BROKERS" default:"kafka:9092"`
+	Topic       string        `envconfig:"KAFKA_TOPIC" default:"orders"`
+	GroupID     string        `envconfig:"KAFKA_GROUP_ID" default:"order-service"`
+	StartOffset string        `envconfig:"KAFKA_START_OFFSET" default:"first"` // first | last
+	MinBytes    int           `envconfig:"KAFKA_MIN_BYTES" default:"1"`
+	MaxBytes    int           `envconfig:"KAFKA_MAX_BYTES" default:"10000000"`
+	MaxWait     time.Duration `envconfig:"KAFKA_MAX_WAIT" default:"10s"`
+	DLQTopic    string        `envconfig:"KAFKA_DLQ_TOPIC" default:"orders.dlq"`
+
+	QuarantineTopic string `envconfig:"KAFKA_QUARANTINE_TOPIC" default:"orders.quarantine"`
+
+	SASLMechanism string `envconfig:"KAFKA_SASL_MECHANISM"` // plain | scram-sha-256 | scram-sha-512
+	SASLUsername  string `envconfig:"KAFKA_SASL_USERNAME"`
+	SASLPassword  string `envconfig:"KAFKA_SASL_PASSWORD"`
+
+	TLSEnabled            bool   `envconfig:"KAFKA_TLS_ENABLED" default:"false"`
+	TLSCAFile             string `envconfig:"KAFKA_TLS_CA_FILE"`
+	TLSCertFile           string `envconfig:"KAFKA_TLS_CERT_FILE"`
+	TLSKeyFile            string `envconfig:"KAFKA_TLS_KEY_FILE"`
+	TLSInsecureSkipVerify bool   `envconfig:"KAFKA_TLS_INSECURE_SKIP_VERIFY" default:"false"`
+}
+
+// NATS — JetStream: заказы читаются durable pull-консьюмером из стрима,
+// DLQ и карантин публикуются в subject'ы, покрытые каким-либо стримом.
+type NATS struct {
+	URL               string `envconfig:"NATS_URL" default:"nats://nats:4222"`
+	Stream            string `envconfig:"NATS_STREAM" default:"ORDERS"`
+	Subject           string `envconfig:"NATS_SUBJECT" default:"orders"`
+	Durable           string `envconfig:"NATS_DURABLE" default:"order-service"`
+	DLQSubject        string `envconfig:"NATS_DLQ_SUBJECT" default:"orders.dlq"`
+	QuarantineSubject string `envconfig:"NATS_QUARANTINE_SUBJECT" default:"orders.quarantine"`
+	// Неподтвержденное за это время сообщение доставляется повторно
+	AckWait time.Duration `envconfig:"NATS_ACK_WAIT" default:"30s"`
+	// Задержка повторной доставки сообщения, от которого отказался консьюмер
+	NakDelay  time.Duration `envconfig:"NATS_NAK_DELAY" default:"5s"`
+	CredsFile string        `envconfig:"NATS_CREDS_FILE"`
+	TLSCAFile string        `envconfig:"NATS_TLS_CA_FILE"`
+}
+
+type Consumer struct {
+	// Сообщения с одним ключом (order_uid) всегда попадают к одному воркеру
+	Workers   int `envconfig:"CONSUMER_WORKERS" default:"4"`
+	QueueSize int `envconfig:"CONSUMER_QUEUE_SIZE" default:"64"` // на воркер
+	// Сколько полученных сообщений может ждать подтверждения брокеру
+	MaxInFlight int `envconfig:"CONSUMER_MAX_IN_FLIGHT" default:"1000"`
+
+	// Ретраи записи в БД, общие для всех брокеров
+	RetryMaxAttempts    int           `envconfig:"CONSUMER_RETRY_MAX_ATTEMPTS" default:"5"`
+	RetryInitialBackoff time.Duration `envconfig:"CONSUMER_RETRY_INITIAL_BACKOFF" default:"200ms"`
+	RetryMaxBackoff     time.Duration `envconfig:"CONSUMER_RETRY_MAX_BACKOFF" default:"10s"`
+	RetryMultiplier     float64       `envconfig:"CONSUMER_RETRY_MULTIPLIER" default:"2"`
+	RetryJitter         float64       `envconfig:"CONSUMER_RETRY_JITTER" default:"0.5"`
+}
+
+type Validation struct {
+	Currencies    []string `envconfig:"VALIDATION_CURRENCIES" default:"RUB,USD,EUR,KZT,BYN"`
+	DisabledRules []string `envconfig:"VALIDATION_DISABLED_RULES"`
+}
+
+type Cache struct {
+	MaxEntries int           `envconfig:"CACHE_MAX_ENTRIES" default:"100000"`
+	MaxBytes   int64         `envconfig:"CACHE_MAX_BYTES" default:"0"`
+	TTL        time.Duration `envconfig:"CACHE_TTL" default:"0"`
+	// Сколько помнить «заказ не найден»; 0 отключает негативный кэш
+	NegativeTTL        time.Duration `envconfig:"CACHE_NEGATIVE_TTL" default:"30s"`
+	NegativeMaxEntries int           `envconfig:"CACHE_NEGATIVE_MAX_ENTRIES" default:"10000"`
+}
+
+type Warmup struct {
+	Enabled          bool          `envconfig:"WARMUP_ENABLED" default:"true"`
+	BatchSize        int           `envconfig:"WARMUP_BATCH_SIZE" default:"1000"`
+	MaxOrders        int           `envconfig:"WARMUP_MAX_ORDERS" default:"0"`
+	MaxAge           time.Duration `envconfig:"WARMUP_MAX_AGE" default:"0"`
+	Timeout          time.Duration `envconfig:"WARMUP_TIMEOUT" default:"5m"`
+	ProgressInterval time.Duration `envconfig:"WARMUP_PROGRESS_INTERVAL" default:"5s"`
+}
+
+type Health struct {
+	CheckTimeout    time.Duration `envconfig:"HEALTH_CHECK_TIMEOUT" default:"2s"`
+	PostgresTimeout time.Duration `envconfig:"HEALTH_POSTGRES_TIMEOUT" default:"2s"`
+	KafkaTimeout    time.Duration `envconfig:"HEALTH_KAFKA_TIMEOUT" default:"3s"`
+}
+
+type Tracing struct {
+	Exporter     string  `envconfig:"TRACING_EXPORTER" default:"none"` // none | stdout | otlp
+	ServiceName  string  `envconfig:"OTEL_SERVICE_NAME" default:"order-service"`
+	OTLPEndpoint string  `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"localhost:4318"`
+	OTLPInsecure bool    `envconfig:"OTEL_EXPORTER_OTLP_INSECURE" default:"true"`
+	SampleRatio  float64 `envconfig:"TRACING_SAMPLE_RATIO" default:"1"`
+}
+
+type Redaction struct {
+	// Правила вида поле:стратегия (none | full | partial | email | initials)
+	// поверх встроенных; поле без правила маскируется целиком
+	Rules map[string]string `envconfig:"REDACTION_RULES"`
+	// Скоупы, которым PII в ответах API отдается без маскирования
+	PIIScopes []string `envconfig:"REDACTION_PII_SCOPES" default:"orders:read:pii,admin"`
+}
+
+type Auth struct {
+	// При выключенной аутентификации все запросы получают AnonymousScopes
+	Enabled         bool     `envconfig:"AUTH_ENABLED" default:"true"`
+	AnonymousScopes []string `envconfig:"AUTH_ANONYMOUS_SCOPES" default:"orders:read"`
+	// Статические ключи вида имя:sha256-hex:скоуп1|скоуп2
+	APIKeys       []string `envconfig:"AUTH_API_KEYS"`
+	APIKeysFromDB bool     `envconfig:"AUTH_API_KEYS_FROM_DB" default:"false"`
+	// JWT проверяются по локальному JWKS; без файла bearer-токены не принимаются
+	JWKSFile    string        `envconfig:"AUTH_JWKS_FILE"`
+	JWTIssuer   string        `envconfig:"AUTH_JWT_ISSUER"`
+	JWTAudience string        `envconfig:"AUTH_JWT_AUDIENCE"`
+	JWTLeeway   time.Duration `envconfig:"AUTH_JWT_LEEWAY" default:"30s"`
+}
+
+type RateLimit struct {
+	Enabled bool `envconfig:"RATE_LIMIT_ENABLED" default:"true"`
+	// Лимиты групп маршрутов вида группа:запросов_в_секунду/burst
+	Groups map[string]string `envconfig:"RATE_LIMIT_GROUPS" default:"auth:50/100,orders:20/40,search:5/10,admin:2/5"`
+	// Сколько хранить состояние клиента, от которого не было запросов
+	IdleTTL time.Duration `envconfig:"RATE_LIMIT_IDLE_TTL" default:"10m"`
+}
+
+type Outbox struct {
+	Enabled bool `envconfig:"OUTBOX_ENABLED" default:"true"`
+	// Топик для order.persisted; брокеры, SASL и TLS берутся из KAFKA_*
+	Topic        string        `envconfig:"OUTBOX_TOPIC" default:"orders.persisted"`
+	BatchSize    int           `envconfig:"OUTBOX_BATCH_SIZE" default:"100"`
+	PollInterval time.Duration `envconfig:"OUTBOX_POLL_INTERVAL" default:"1s"`
+	// На это время забранные события скрыты от других проходов relay'я
+	Lease               time.Duration `envconfig:"OUTBOX_LEASE" default:"30s"`
+	RetryInitialBackoff time.Duration `envconfig:"OUTBOX_RETRY_INITIAL_BACKOFF" default:"1s"`
+	RetryMaxBackoff     time.Duration `envconfig:"OUTBOX_RETRY_MAX_BACKOFF" default:"5m"`
+}
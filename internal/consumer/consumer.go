@@ -3,123 +3,237 @@ package consumer
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"hash/fnv"
+	"log/slog"
+	"sync"
 	"time"
 
-	"github.com/segmentio/kafka-go"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
 	"github.com/yakovleviga/brokerService/internal/cache"
+	"github.com/yakovleviga/brokerService/internal/config"
 	"github.com/yakovleviga/brokerService/internal/db"
-	"github.com/yakovleviga/brokerService/internal/models"
+	"github.com/yakovleviga/brokerService/internal/logger"
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/tracing"
+	"github.com/yakovleviga/brokerService/internal/validation"
 )
 
-func FullOrderToModelOrder(fo db.FullOrder) models.Order {
-	items := make([]models.Item, len(fo.Items))
-	for i, item := range fo.Items {
-		items[i] = models.Item{
-			ChrtID:      int(item.ChrtID),
-			TrackNumber: item.TrackNumber,
-			Price:       item.Price,
-			Rid:         item.Rid,
-			Name:        item.Name,
-			Sale:        item.Sale,
-			Size:        item.Size,
-			TotalPrice:  item.TotalPrice,
-			NmID:        item.NmID,
-			Brand:       item.Brand,
-			Status:      item.Status,
-		}
-	}
+// Consumer обрабатывает заказы из любого broker.MessageSource. Источник и
+// приемники DLQ принадлежат вызывающему и закрываются им после Run.
+//
+// Сообщения раздаются пулу воркеров по хешу ключа (order_uid): события одного
+// заказа обрабатываются по порядку, разных — параллельно. Подтверждаются
+// сообщения партиции строго по порядку offset'ов.
+type Consumer struct {
+	cfg       config.Consumer
+	log       *slog.Logger
+	source    broker.MessageSource
+	processor *processor
+	offsets   *offsetTracker
+}
 
-	return models.Order{
-		OrderUID:          fo.OrderUID,
-		TrackNumber:       fo.TrackNumber,
-		Entry:             fo.Entry,
-		Locale:            fo.Locale,
-		InternalSignature: fo.InternalSignature,
-		CustomerID:        fo.CustomerID,
-		DeliveryService:   fo.DeliveryService,
-		ShardKey:          fo.ShardKey,
-		SmID:              fo.SmID,
-		DateCreated:       fo.DateCreated,
-		OofShard:          fo.OofShard,
-		Delivery: models.Delivery{
-			Name:    fo.Delivery.Name,
-			Phone:   fo.Delivery.Phone,
-			Zip:     fo.Delivery.Zip,
-			City:    fo.Delivery.City,
-			Address: fo.Delivery.Address,
-			Region:  fo.Delivery.Region,
-			Email:   fo.Delivery.Email,
-		},
-		Payment: models.Payment{
-			Transaction:  fo.Payment.Transaction,
-			RequestID:    fo.Payment.RequestID,
-			Currency:     fo.Payment.Currency,
-			Provider:     fo.Payment.Provider,
-			Amount:       fo.Payment.Amount,
-			PaymentDT:    fo.Payment.PaymentDT,
-			Bank:         fo.Payment.Bank,
-			DeliveryCost: fo.Payment.DeliveryCost,
-			GoodsTotal:   fo.Payment.GoodsTotal,
-			CustomFee:    fo.Payment.CustomFee,
+type result struct {
+	msg broker.Message
+	ok  bool
+}
+
+func NewConsumer(cfg config.Consumer, source broker.MessageSource, dlq, quarantine broker.Sink, retry RetryPolicy, repo db.Repository, cache *cache.Cache, validator *validation.Validator, log *slog.Logger) *Consumer {
+	log = log.With("component", "consumer")
+
+	return &Consumer{
+		cfg:    cfg,
+		log:    log,
+		source: source,
+		processor: &processor{
+			repo:       repo,
+			cache:      cache,
+			dlq:        NewDeadLetterWriter(dlq),
+			quarantine: NewDeadLetterWriter(quarantine),
+			retry:      retry,
+			validator:  validator,
+			log:        log,
 		},
-		Items: items,
+		offsets: newOffsetTracker(),
 	}
 }
 
-func ConsumeKafka(repo db.Repository, cache *cache.Cache) {
-	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:   []string{"kafka:9092"},
-		Topic:     "orders",
-		Partition: 0,
-		MinBytes:  1,
-		MaxBytes:  10e6,
-	})
-	defer r.Close()
+// Run читает сообщения до отмены ctx. Сообщения, которые уже обрабатываются,
+// дописываются в БД и подтверждаются; ожидание между ретраями прерывается,
+// а еще не начатые сообщения возвращаются брокеру.
+func (c *Consumer) Run(ctx context.Context) error {
+	workers := max(c.cfg.Workers, 1)
+	c.log.Info("consumer started", "workers", workers)
+
+	queues := make([]chan broker.Message, workers)
+	results := make(chan result, workers)
+	inFlight := make(chan struct{}, max(c.cfg.MaxInFlight, 1))
+
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan broker.Message, max(c.cfg.QueueSize, 1))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range queues[i] {
+				results <- result{msg: m, ok: c.process(ctx, m)}
+			}
+		}()
+	}
+
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		c.commit(ctx, results, inFlight)
+	}()
+
+	c.fetch(ctx, queues, inFlight)
+
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	close(results)
+	<-committed
 
-	fmt.Println("Consumer started, waiting for messages...")
+	c.log.Info("consumer stopped")
+	return nil
+}
 
+func (c *Consumer) fetch(ctx context.Context, queues []chan broker.Message, inFlight chan struct{}) {
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		m, err := r.ReadMessage(ctx)
-		cancel()
+		// Не читаем дальше, пока слишком много сообщений ждут подтверждения
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		m, err := c.source.Fetch(ctx)
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			time.Sleep(time.Second)
+			<-inFlight
+			if ctx.Err() != nil || errors.Is(err, broker.ErrClosed) {
+				return
+			}
+			c.log.Error("failed to fetch message", "error", err)
+			if err := sleepContext(ctx, time.Second); err != nil {
+				return
+			}
 			continue
 		}
 
-		var fullOrder db.FullOrder
-		if err := json.Unmarshal(m.Value, &fullOrder); err != nil {
-			log.Println("JSON parse error:", err)
+		c.log.Debug("message received", "partition", m.Partition, "offset", m.Offset, "key", string(m.Key))
+		partition := metrics.Partition(m.Partition)
+		metrics.MessagesConsumed.WithLabelValues(partition).Inc()
+		metrics.ConsumerLag.WithLabelValues(partition).Set(float64(max(m.HighWaterMark-m.Offset-1, 0)))
+
+		isNew, dispatch := c.offsets.add(m)
+		if isNew {
+			metrics.ConsumerInFlight.Inc()
+		} else {
+			// Место в окне уже занято первой доставкой
+			<-inFlight
+		}
+		if !dispatch {
 			continue
 		}
 
-		if fullOrder.OrderUID == "" {
-			log.Println("FullOrder missing order_uid, skipping")
-			continue
+		select {
+		case queues[workerFor(m, len(queues))] <- m:
+		case <-ctx.Done():
+			if err := c.source.Nack(context.WithoutCancel(ctx), m); err != nil {
+				c.log.Error("failed to nack message", "partition", m.Partition, "offset", m.Offset, "error", err)
+			}
+			return
 		}
+	}
+}
 
-		orderModel := FullOrderToModelOrder(fullOrder)
+// process обрабатывает сообщение и сообщает, можно ли его подтвердить.
+// Пропустить сообщение нельзя (например, при недоступном DLQ), поэтому
+// воркер повторяет его до успеха, а следующие события того же заказа ждут
+// в его очереди. false — консьюмер остановлен.
+func (c *Consumer) process(ctx context.Context, m broker.Message) bool {
+	msgLog := c.log.With("partition", m.Partition, "offset", m.Offset)
 
-		ctxDB, cancelDB := context.WithTimeout(context.Background(), 5*time.Second)
-		err = repo.InsertOrder(ctxDB, orderModel)
-		cancelDB()
+	for ctx.Err() == nil {
+		msgCtx, span := tracing.StartConsumerSpan(ctx, m)
+		msgCtx = logger.WithContext(msgCtx, msgLog)
+		err := c.processor.handle(msgCtx, m)
+		tracing.End(span, &err)
+		if err == nil {
+			return true
+		}
 
-		if err != nil {
-			log.Println("DB insert error:", err)
+		msgLog.Warn("message not committed", "error", err)
+		if err := sleepContext(ctx, max(c.processor.retry.MaxBackoff, time.Second)); err != nil {
+			break
+		}
+	}
+	return false
+}
+
+// commit подтверждает готовые префиксы партиций. Результаты, накопившиеся
+// за время коммита, подтверждаются одним вызовом.
+func (c *Consumer) commit(ctx context.Context, results <-chan result, inFlight chan struct{}) {
+	ctx = context.WithoutCancel(ctx)
+
+	for r := range results {
+		ready := c.complete(ctx, r)
+	drain:
+		for {
+			select {
+			case r, ok := <-results:
+				if !ok {
+					break drain
+				}
+				ready = append(ready, c.complete(ctx, r)...)
+			default:
+				break drain
+			}
+		}
+		if len(ready) == 0 {
 			continue
 		}
 
-		cache.Set(fullOrder)
+		if err := c.source.Ack(ctx, ready...); err != nil {
+			c.log.Error("failed to commit messages", "count", len(ready), "error", err)
+		}
+		for range ready {
+			<-inFlight
+		}
+		metrics.ConsumerInFlight.Sub(float64(len(ready)))
+	}
+}
 
-		if err := r.CommitMessages(context.Background(), m); err != nil {
-			log.Println("Commit error:", err)
-		} else {
-			log.Printf("Order %s saved successfully", fullOrder.OrderUID)
+func (c *Consumer) complete(ctx context.Context, r result) []broker.Message {
+	if !r.ok {
+		// Не обработано из-за остановки: брокер доставит сообщение снова
+		if err := c.source.Nack(ctx, r.msg); err != nil {
+			c.log.Error("failed to nack message", "partition", r.msg.Partition, "offset", r.msg.Offset, "error", err)
 		}
+	}
+	return c.offsets.complete(r.msg, r.ok)
+}
 
-		fmt.Printf("Received message at offset %d: key=%s\n", m.Offset, string(m.Key))
+// workerFor выбирает воркера по ключу сообщения, а без ключа — по order_uid
+// из тела, чтобы события одного заказа попадали в одну очередь
+func workerFor(m broker.Message, workers int) int {
+	if workers == 1 {
+		return 0
 	}
+
+	key := m.Key
+	if len(key) == 0 {
+		var event struct {
+			OrderUID string `json:"order_uid"`
+		}
+		_ = json.Unmarshal(m.Value, &event)
+		key = []byte(event.OrderUID)
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(workers))
 }
@@ -0,0 +1,363 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
+	"github.com/yakovleviga/brokerService/internal/cache"
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/models"
+	"github.com/yakovleviga/brokerService/internal/validation"
+)
+
+// fakeRepo реализует только то, что нужно консьюмеру для событий
+// обновления заказа; остальные методы db.Repository не вызываются.
+type fakeRepo struct {
+	db.Repository
+
+	// apply вызывается перед сохранением события; ошибка не дает его сохранить
+	apply   func(e models.Event) error
+	pingErr error
+
+	mu       sync.Mutex
+	attempts int
+	applied  []models.Event
+}
+
+func (r *fakeRepo) ApplyOrderEvent(_ context.Context, e models.Event) error {
+	r.mu.Lock()
+	r.attempts++
+	r.mu.Unlock()
+
+	if r.apply != nil {
+		if err := r.apply(e); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.applied = append(r.applied, e)
+	return nil
+}
+
+func (r *fakeRepo) GetFullOrder(_ context.Context, orderUID string) (*db.FullOrder, error) {
+	return &db.FullOrder{OrderUID: orderUID}, nil
+}
+
+func (r *fakeRepo) Ping(context.Context) error {
+	return r.pingErr
+}
+
+func (r *fakeRepo) Attempts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts
+}
+
+func (r *fakeRepo) Applied() []models.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.applied)
+}
+
+func statusEvent(t *testing.T, orderUID string, version int64) broker.Message {
+	t.Helper()
+
+	payload, err := json.Marshal(models.OrderStatusChanged{Status: "assembling"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := json.Marshal(models.Event{
+		Type:     models.EventOrderStatusChanged,
+		OrderUID: orderUID,
+		Version:  version,
+		Payload:  payload,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker.Message{Topic: "orders", Key: []byte(orderUID), Value: value}
+}
+
+// startConsumer запускает консьюмер поверх брокера в памяти; возвращенная
+// функция останавливает его и ждет завершения Run.
+func startConsumer(t *testing.T, b *broker.Broker, source broker.MessageSource, repo db.Repository, workers int) (stop func()) {
+	t.Helper()
+
+	c := NewConsumer(
+		config.Consumer{Workers: workers, QueueSize: 8, MaxInFlight: 64},
+		source, b.DLQ, b.Quarantine,
+		RetryPolicy{MaxAttempts: 1},
+		repo,
+		cache.NewCache(config.Cache{}),
+		validation.NewValidator(config.Validation{}),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := c.Run(ctx); err != nil {
+			t.Errorf("consumer run: %v", err)
+		}
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("consumer did not stop")
+			}
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func offsets(msgs []broker.Message) []int64 {
+	out := make([]int64, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Offset
+	}
+	return out
+}
+
+func header(m broker.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestConsumerAcksProcessedMessages(t *testing.T) {
+	b := broker.NewMemoryBroker(64)
+	source := b.Source.(*broker.MemorySource)
+	repo := &fakeRepo{}
+	startConsumer(t, b, source, repo, 4)
+
+	ctx := context.Background()
+	var want []int64
+	for i := range 20 {
+		if err := source.Send(ctx, statusEvent(t, "order-"+strconv.Itoa(i%5), int64(i/5+1))); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, int64(i))
+	}
+
+	waitFor(t, "all messages acked", func() bool { return len(source.Acked()) == len(want) })
+
+	if got := offsets(source.Acked()); !slices.Equal(got, want) {
+		t.Fatalf("acked offsets %v, want %v", got, want)
+	}
+	if n := len(repo.Applied()); n != len(want) {
+		t.Fatalf("applied %d events, want %d", n, len(want))
+	}
+	if nacked := source.Nacked(); len(nacked) != 0 {
+		t.Fatalf("nacked %v, want none", offsets(nacked))
+	}
+}
+
+func TestConsumerDeadLetters(t *testing.T) {
+	b := broker.NewMemoryBroker(64)
+	source := b.Source.(*broker.MemorySource)
+	repo := &fakeRepo{apply: func(e models.Event) error {
+		if e.OrderUID == "poison" {
+			return errors.Wrap(db.ErrInvalidEvent, "status is not allowed")
+		}
+		return nil
+	}}
+	startConsumer(t, b, source, repo, 2)
+
+	noUID, err := json.Marshal(models.Event{Type: models.EventOrderStatusChanged, Version: 1, Payload: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = source.Send(context.Background(),
+		broker.Message{Key: []byte("broken"), Value: []byte("{not json")},
+		broker.Message{Value: noUID},
+		statusEvent(t, "poison", 1),
+		statusEvent(t, "order-1", 1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "all messages acked", func() bool { return len(source.Acked()) == 4 })
+
+	dlq := b.DLQ.(*broker.MemorySink).Messages()
+	if len(dlq) != 2 {
+		t.Fatalf("DLQ has %d messages, want 2", len(dlq))
+	}
+	for i, stage := range []string{StageParse, StageValidate} {
+		if got := header(dlq[i], HeaderDLQStage); got != stage {
+			t.Errorf("DLQ message %d stage %q, want %q", i, got, stage)
+		}
+		if got, want := header(dlq[i], HeaderDLQSourceOffset), strconv.Itoa(i); got != want {
+			t.Errorf("DLQ message %d source offset %q, want %q", i, got, want)
+		}
+	}
+
+	quarantine := b.Quarantine.(*broker.MemorySink).Messages()
+	if len(quarantine) != 1 {
+		t.Fatalf("quarantine has %d messages, want 1", len(quarantine))
+	}
+	if got := string(quarantine[0].Key); got != "poison" {
+		t.Errorf("quarantined key %q, want poison", got)
+	}
+	if got := header(quarantine[0], HeaderDLQStage); got != StagePersist {
+		t.Errorf("quarantine stage %q, want %q", got, StagePersist)
+	}
+
+	applied := repo.Applied()
+	if len(applied) != 1 || applied[0].OrderUID != "order-1" {
+		t.Fatalf("applied %+v, want only order-1", applied)
+	}
+}
+
+func TestConsumerRedeliversUnfinishedOnStop(t *testing.T) {
+	b := broker.NewMemoryBroker(64)
+	source := b.Source.(*broker.MemorySource)
+
+	// БД недоступна: консьюмер держит сообщение и ждет ее восстановления
+	down := &fakeRepo{
+		apply:   func(models.Event) error { return errors.New("connection reset by peer") },
+		pingErr: errors.New("connection refused"),
+	}
+	stop := startConsumer(t, b, source, down, 1)
+
+	if err := source.Send(context.Background(), statusEvent(t, "order-1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "first attempt", func() bool { return down.Attempts() > 0 })
+	stop()
+
+	if acked := source.Acked(); len(acked) != 0 {
+		t.Fatalf("acked %v while the database was down", offsets(acked))
+	}
+	if got := offsets(source.Nacked()); !slices.Equal(got, []int64{0}) {
+		t.Fatalf("nacked %v, want [0]", got)
+	}
+
+	// Следующий запуск получает то же сообщение повторно
+	up := &fakeRepo{}
+	startConsumer(t, b, source, up, 1)
+	waitFor(t, "redelivered message acked", func() bool { return len(source.Acked()) == 1 })
+
+	if got := offsets(source.Acked()); !slices.Equal(got, []int64{0}) {
+		t.Fatalf("acked %v, want [0]", got)
+	}
+	if applied := up.Applied(); len(applied) != 1 || applied[0].OrderUID != "order-1" {
+		t.Fatalf("applied %+v after redelivery, want order-1", applied)
+	}
+}
+
+// ackChecker проверяет каждый коммит: подтверждаются только уже
+// сохраненные сообщения, и offset'ы партиции идут подряд без пропусков.
+type ackChecker struct {
+	*broker.MemorySource
+	t    *testing.T
+	repo *fakeRepo
+
+	mu   sync.Mutex
+	next int64
+}
+
+func (s *ackChecker) Ack(ctx context.Context, msgs ...broker.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := make(map[string]bool)
+	for _, e := range s.repo.Applied() {
+		applied[e.OrderUID+"/"+strconv.FormatInt(e.Version, 10)] = true
+	}
+	for _, m := range msgs {
+		if m.Offset != s.next {
+			s.t.Errorf("committed offset %d, want %d: commit skipped an unfinished message", m.Offset, s.next)
+		}
+		s.next = m.Offset + 1
+
+		e, err := decodeEvent(m.Value)
+		if err != nil {
+			s.t.Errorf("committed undecodable message at offset %d: %v", m.Offset, err)
+			continue
+		}
+		if !applied[e.OrderUID+"/"+strconv.FormatInt(e.Version, 10)] {
+			s.t.Errorf("committed offset %d (%s v%d) before it was saved", m.Offset, e.OrderUID, e.Version)
+		}
+	}
+	return s.MemorySource.Ack(ctx, msgs...)
+}
+
+func TestConsumerKeepsKeyOrderAndCommitsFinishedPrefix(t *testing.T) {
+	const (
+		orders   = 8
+		versions = 25
+		total    = orders * versions
+	)
+
+	b := broker.NewMemoryBroker(total)
+	source := b.Source.(*broker.MemorySource)
+	repo := &fakeRepo{apply: func(e models.Event) error {
+		// Заказы обрабатываются с разной скоростью, чтобы сообщения
+		// завершались не в порядке offset'ов
+		if e.OrderUID == "order-0" || e.Version%7 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	}}
+	checker := &ackChecker{MemorySource: source, t: t, repo: repo}
+	startConsumer(t, b, checker, repo, 4)
+
+	var msgs []broker.Message
+	for v := 1; v <= versions; v++ {
+		for o := range orders {
+			msgs = append(msgs, statusEvent(t, "order-"+strconv.Itoa(o), int64(v)))
+		}
+	}
+	if err := source.Send(context.Background(), msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "all messages acked", func() bool { return len(source.Acked()) == total })
+
+	last := make(map[string]int64)
+	for _, e := range repo.Applied() {
+		if e.Version != last[e.OrderUID]+1 {
+			t.Fatalf("%s: applied v%d after v%d", e.OrderUID, e.Version, last[e.OrderUID])
+		}
+		last[e.OrderUID] = e.Version
+	}
+	if len(last) != orders {
+		t.Fatalf("applied events for %d orders, want %d", len(last), orders)
+	}
+}
@@ -0,0 +1,84 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
+	"github.com/yakovleviga/brokerService/internal/validation"
+)
+
+// Этапы обработки, на которых сообщение может попасть в DLQ
+const (
+	StageParse    = "parse"
+	StageValidate = "validate"
+	StagePersist  = "persist"
+	// StageStale — событие отброшено как устаревшее, в DLQ не попадает
+	StageStale = "stale"
+)
+
+const (
+	HeaderDLQStage           = "x-dlq-stage"
+	HeaderDLQError           = "x-dlq-error"
+	HeaderDLQAttempts        = "x-dlq-attempts"
+	HeaderDLQSourceTopic     = "x-dlq-source-topic"
+	HeaderDLQSourcePartition = "x-dlq-source-partition"
+	HeaderDLQSourceOffset    = "x-dlq-source-offset"
+	HeaderDLQFailedAt        = "x-dlq-failed-at"
+	// JSON-массив validation.FieldError, если сообщение не прошло валидацию
+	HeaderDLQValidationErrors = "x-dlq-validation-errors"
+)
+
+type DeadLetter struct {
+	Message  broker.Message
+	Stage    string
+	Err      error
+	Attempts int
+}
+
+// DeadLetterWriter публикует исходное сообщение с заголовками о причине отказа
+type DeadLetterWriter struct {
+	sink broker.Sink
+}
+
+func NewDeadLetterWriter(sink broker.Sink) *DeadLetterWriter {
+	return &DeadLetterWriter{sink: sink}
+}
+
+func (w *DeadLetterWriter) Publish(ctx context.Context, dl DeadLetter) error {
+	headers := make([]broker.Header, 0, len(dl.Message.Headers)+8)
+	headers = append(headers, dl.Message.Headers...)
+
+	errText := ""
+	if dl.Err != nil {
+		errText = dl.Err.Error()
+	}
+
+	headers = append(headers,
+		broker.Header{Key: HeaderDLQStage, Value: []byte(dl.Stage)},
+		broker.Header{Key: HeaderDLQError, Value: []byte(errText)},
+		broker.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(dl.Attempts))},
+		broker.Header{Key: HeaderDLQSourceTopic, Value: []byte(dl.Message.Topic)},
+		broker.Header{Key: HeaderDLQSourcePartition, Value: []byte(strconv.Itoa(dl.Message.Partition))},
+		broker.Header{Key: HeaderDLQSourceOffset, Value: []byte(strconv.FormatInt(dl.Message.Offset, 10))},
+		broker.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+
+	var validationErrs validation.Errors
+	if errors.As(dl.Err, &validationErrs) {
+		if payload, err := json.Marshal(validationErrs); err == nil {
+			headers = append(headers, broker.Header{Key: HeaderDLQValidationErrors, Value: payload})
+		}
+	}
+
+	err := w.sink.Publish(ctx, broker.Message{
+		Key:     dl.Message.Key,
+		Value:   dl.Message.Value,
+		Headers: headers,
+	})
+	return errors.Wrap(err, "failed to publish message to DLQ")
+}
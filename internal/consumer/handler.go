@@ -0,0 +1,271 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
+	"github.com/yakovleviga/brokerService/internal/cache"
+	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/logger"
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/models"
+	"github.com/yakovleviga/brokerService/internal/tracing"
+	"github.com/yakovleviga/brokerService/internal/validation"
+)
+
+type processor struct {
+	repo       db.Repository
+	cache      *cache.Cache
+	dlq        *DeadLetterWriter
+	quarantine *DeadLetterWriter
+	retry      RetryPolicy
+	validator  *validation.Validator
+	log        *slog.Logger
+}
+
+// handle возвращает ошибку только если сообщение нельзя коммитить
+func (p *processor) handle(ctx context.Context, m broker.Message) error {
+	_, span := tracing.Start(ctx, "unmarshal")
+	event, err := decodeEvent(m.Value)
+	tracing.End(span, &err)
+	if err != nil {
+		p.logger(ctx).Warn("failed to parse message", "error", err)
+		return p.deadLetter(ctx, p.dlq, m, StageParse, err, 1)
+	}
+
+	if event.OrderUID == "" {
+		p.logger(ctx).Warn("event missing order_uid")
+		return p.deadLetter(ctx, p.dlq, m, StageValidate, errors.New("missing order_uid"), 1)
+	}
+	ctx = logger.WithContext(ctx, p.logger(ctx).With("order_uid", event.OrderUID, "event_type", event.Type))
+	metrics.MessagesParsed.WithLabelValues(metrics.Partition(m.Partition)).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("order.uid", event.OrderUID),
+		attribute.String("order.event_type", string(event.Type)),
+		attribute.Int64("order.version", event.Version),
+	)
+
+	if event.Type == models.EventOrderCreated {
+		return p.handleSnapshot(ctx, m, event)
+	}
+	return p.handleUpdate(ctx, m, event)
+}
+
+// decodeEvent понимает как конверт models.Event, так и «голый» снимок заказа,
+// который продюсеры отправляли до появления событий.
+func decodeEvent(value []byte) (models.Event, error) {
+	var event models.Event
+	if err := json.Unmarshal(value, &event); err != nil {
+		return event, err
+	}
+
+	if event.Type == "" {
+		return models.Event{
+			Type:     models.EventOrderCreated,
+			OrderUID: event.OrderUID,
+			Version:  event.Version,
+			Payload:  value,
+		}, nil
+	}
+
+	switch event.Type {
+	case models.EventOrderCreated,
+		models.EventOrderStatusChanged,
+		models.EventItemStatusChanged,
+		models.EventDeliveryUpdated,
+		models.EventOrderCancelled:
+		return event, nil
+	default:
+		return event, errors.Errorf("unknown event type %q", event.Type)
+	}
+}
+
+func (p *processor) handleSnapshot(ctx context.Context, m broker.Message, event models.Event) error {
+	var orderModel models.Order
+	_, span := tracing.Start(ctx, "unmarshal order")
+	err := json.Unmarshal(event.Payload, &orderModel)
+	tracing.End(span, &err)
+	if err != nil {
+		p.logger(ctx).Warn("failed to parse order payload", "error", err)
+		return p.deadLetter(ctx, p.dlq, m, StageParse, err, 1)
+	}
+
+	if orderModel.OrderUID != event.OrderUID {
+		return p.deadLetter(ctx, p.dlq, m, StageValidate, errors.New("payload order_uid does not match event"), 1)
+	}
+
+	_, span = tracing.Start(ctx, "validate")
+	err = p.validator.Validate(orderModel)
+	tracing.End(span, &err)
+	if err != nil {
+		p.logger(ctx).Warn("order rejected by validation", "error", err)
+		return p.deadLetter(ctx, p.dlq, m, StageValidate, err, 1)
+	}
+
+	orderModel.Version = event.Version
+	if orderModel.Status == "" {
+		orderModel.Status = models.OrderStatusCreated
+	}
+	fullOrder := db.FullOrderFromModel(orderModel)
+
+	var result db.UpsertResult
+	done, err := p.persist(ctx, m, func(ctx context.Context) error {
+		var err error
+		result, err = p.repo.InsertOrder(ctx, orderModel)
+		return err
+	})
+	if !done {
+		return err
+	}
+	if errors.Is(err, db.ErrStaleEvent) {
+		p.logger(ctx).Info("stale order snapshot skipped", "version", event.Version)
+		metrics.MessagesRejected.WithLabelValues(metrics.Partition(m.Partition), StageStale).Inc()
+		return nil
+	}
+	if err != nil {
+		// Сообщение уже в карантине
+		return nil
+	}
+
+	if result != db.UpsertUnchanged {
+		_, span = tracing.Start(ctx, "cache set")
+		p.cache.Set(fullOrder)
+		span.End()
+	} else {
+		// Заказ уже был в БД: «не найден», запомненный API в гонке, неверен
+		p.cache.ForgetNotFound(fullOrder)
+	}
+	p.logger(ctx).Info("order saved", "result", result)
+	metrics.MessagesPersisted.WithLabelValues(metrics.Partition(m.Partition), string(result)).Inc()
+
+	return nil
+}
+
+func (p *processor) handleUpdate(ctx context.Context, m broker.Message, event models.Event) error {
+	if event.Type == models.EventDeliveryUpdated {
+		var delivery models.Delivery
+		if err := json.Unmarshal(event.Payload, &delivery); err != nil {
+			return p.deadLetter(ctx, p.dlq, m, StageParse, err, 1)
+		}
+		_, span := tracing.Start(ctx, "validate")
+		err := p.validator.ValidateDelivery(delivery)
+		tracing.End(span, &err)
+		if err != nil {
+			p.logger(ctx).Warn("delivery update rejected by validation", "error", err)
+			return p.deadLetter(ctx, p.dlq, m, StageValidate, err, 1)
+		}
+	}
+
+	done, err := p.persist(ctx, m, func(ctx context.Context) error {
+		return p.repo.ApplyOrderEvent(ctx, event)
+	})
+	if !done {
+		return err
+	}
+	if errors.Is(err, db.ErrStaleEvent) {
+		p.logger(ctx).Info("stale event skipped", "version", event.Version, "error", err)
+		metrics.MessagesRejected.WithLabelValues(metrics.Partition(m.Partition), StageStale).Inc()
+		return nil
+	}
+	if err != nil {
+		// Сообщение уже в карантине
+		return nil
+	}
+
+	// Событие меняет только часть заказа, поэтому перечитываем его целиком
+	ctxDB, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	order, err := p.repo.GetFullOrder(ctxDB, event.OrderUID)
+	cancel()
+	_, span := tracing.Start(ctx, "cache set")
+	if err != nil {
+		p.logger(ctx).Warn("failed to reload order, evicting from cache", "error", err)
+		p.cache.Delete(event.OrderUID)
+	} else {
+		p.cache.Set(*order)
+	}
+	span.End()
+
+	p.logger(ctx).Info("event applied", "version", event.Version)
+	metrics.MessagesPersisted.WithLabelValues(metrics.Partition(m.Partition), string(event.Type)).Inc()
+	return nil
+}
+
+// persist выполняет fn с ретраями. Постоянные ошибки и «ядовитые» сообщения,
+// которые падают при живой БД, уходят в карантин; если же недоступна сама БД,
+// партиция ждет ее восстановления, чтобы не потерять заказ.
+//
+// done=false означает, что сообщение нельзя коммитить (err содержит причину).
+// При done=true err == nil — успех, ErrStaleEvent — устаревшее событие,
+// любая другая ошибка — сообщение уже отправлено в карантин.
+func (p *processor) persist(ctx context.Context, m broker.Message, fn func(ctx context.Context) error) (bool, error) {
+	total := 0
+	for {
+		attempts, err := p.retry.Do(ctx, func(ctx context.Context) error {
+			// Начатую попытку доводим до конца даже при остановке сервиса
+			ctxDB, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			return fn(ctxDB)
+		})
+		total += attempts
+		if err == nil || errors.Is(err, db.ErrStaleEvent) {
+			return true, err
+		}
+		if ctx.Err() != nil {
+			return false, errors.Wrap(ctx.Err(), "consumer is stopping")
+		}
+
+		p.logger(ctx).Error("database operation failed", "attempts", total, "error", err)
+
+		if !IsRetryable(err) {
+			return p.quarantineMessage(ctx, m, err, total)
+		}
+
+		ctxPing, cancel := context.WithTimeout(ctx, 2*time.Second)
+		pingErr := p.repo.Ping(ctxPing)
+		cancel()
+		if pingErr == nil {
+			p.logger(ctx).Warn("message fails while database is healthy, treating as poison")
+			return p.quarantineMessage(ctx, m, err, total)
+		}
+
+		p.logger(ctx).Warn("database unavailable, pausing partition", "error", pingErr)
+		if err := sleepContext(ctx, max(p.retry.MaxBackoff, time.Second)); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (p *processor) quarantineMessage(ctx context.Context, m broker.Message, cause error, attempts int) (bool, error) {
+	if err := p.deadLetter(ctx, p.quarantine, m, StagePersist, cause, attempts); err != nil {
+		return false, err
+	}
+	return true, cause
+}
+
+func (p *processor) deadLetter(ctx context.Context, w *DeadLetterWriter, m broker.Message, stage string, cause error, attempts int) error {
+	err := w.Publish(context.WithoutCancel(ctx), DeadLetter{
+		Message:  m,
+		Stage:    stage,
+		Err:      cause,
+		Attempts: attempts,
+	})
+	if err != nil {
+		return err
+	}
+
+	p.logger(ctx).Warn("message dead-lettered", "stage", stage, "attempts", attempts)
+	metrics.MessagesRejected.WithLabelValues(metrics.Partition(m.Partition), stage).Inc()
+	return nil
+}
+
+// logger возвращает логгер с полями текущего сообщения (partition, offset, order_uid)
+func (p *processor) logger(ctx context.Context) *slog.Logger {
+	return logger.FromContext(ctx, p.log)
+}
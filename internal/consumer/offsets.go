@@ -0,0 +1,95 @@
+package consumer
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
+)
+
+type offsetState int
+
+const (
+	offsetPending offsetState = iota
+	offsetDone
+	offsetFailed
+)
+
+type trackedMessage struct {
+	msg   broker.Message
+	state offsetState
+}
+
+// offsetTracker хранит полученные, но еще не подтвержденные сообщения по
+// партициям. Подтверждать можно только непрерывный от начала партиции
+// префикс обработанных сообщений: иначе коммит offset'а в Kafka
+// «перепрыгнет» заказ, который еще сохраняется другим воркером.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int][]*trackedMessage
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int][]*trackedMessage)}
+}
+
+// add регистрирует полученное сообщение и сообщает, новое ли оно. Повторная
+// доставка (ребаланс, nack) сообщения, которое еще обрабатывается или ждет
+// подтверждения, не новая; неудачное сообщение снова становится ожидающим.
+func (t *offsetTracker) add(m broker.Message) (isNew, dispatch bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := t.partitions[m.Partition]
+	i, found := search(list, m.Offset)
+	if !found {
+		t.partitions[m.Partition] = slices.Insert(list, i, &trackedMessage{msg: m})
+		return true, true
+	}
+	if list[i].state != offsetFailed {
+		return false, false
+	}
+	list[i].msg = m
+	list[i].state = offsetPending
+	return false, true
+}
+
+// complete отмечает результат обработки и возвращает сообщения, которые
+// теперь можно подтвердить, в порядке offset'ов. Неудачное сообщение
+// задерживает подтверждение всех следующих в партиции.
+func (t *offsetTracker) complete(m broker.Message, ok bool) []broker.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := t.partitions[m.Partition]
+	i, found := search(list, m.Offset)
+	if !found {
+		return nil
+	}
+	list[i].state = offsetFailed
+	if ok {
+		list[i].state = offsetDone
+	}
+
+	n := 0
+	for n < len(list) && list[n].state == offsetDone {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	ready := make([]broker.Message, n)
+	for j := range n {
+		ready[j] = list[j].msg
+	}
+	t.partitions[m.Partition] = slices.Delete(list, 0, n)
+	return ready
+}
+
+func search(list []*trackedMessage, offset int64) (int, bool) {
+	return slices.BinarySearchFunc(list, offset, func(e *trackedMessage, offset int64) int {
+		return cmp.Compare(e.msg.Offset, offset)
+	})
+}
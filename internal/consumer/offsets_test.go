@@ -0,0 +1,141 @@
+package consumer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
+)
+
+func msgAt(partition int, offset int64) broker.Message {
+	return broker.Message{Partition: partition, Offset: offset}
+}
+
+type offsetStep struct {
+	// add — получить сообщение, иначе завершить его с результатом ok
+	add       bool
+	partition int
+	offset    int64
+	ok        bool
+
+	wantNew      bool
+	wantDispatch bool
+	// Offset'ы партиции, которые после шага можно подтвердить
+	wantReady []int64
+}
+
+func received(partition int, offset int64) offsetStep {
+	return offsetStep{add: true, partition: partition, offset: offset, wantNew: true, wantDispatch: true}
+}
+
+func done(partition int, offset int64, ready ...int64) offsetStep {
+	return offsetStep{partition: partition, offset: offset, ok: true, wantReady: ready}
+}
+
+func failed(partition int, offset int64) offsetStep {
+	return offsetStep{partition: partition, offset: offset}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []offsetStep
+	}{
+		{
+			name: "in order",
+			steps: []offsetStep{
+				received(0, 0), received(0, 1),
+				done(0, 0, 0),
+				done(0, 1, 1),
+			},
+		},
+		{
+			name: "out of order completion waits for the head",
+			steps: []offsetStep{
+				received(0, 0), received(0, 1), received(0, 2),
+				done(0, 2),
+				done(0, 1),
+				done(0, 0, 0, 1, 2),
+			},
+		},
+		{
+			name: "gaps in offsets",
+			steps: []offsetStep{
+				// Offset'ы compacted-топика или отфильтрованного стрима идут с пропусками
+				received(0, 10), received(0, 15), received(0, 42),
+				done(0, 42),
+				done(0, 10, 10),
+				done(0, 15, 15, 42),
+			},
+		},
+		{
+			name: "failed message holds back the partition until redelivered",
+			steps: []offsetStep{
+				received(0, 0), received(0, 1), received(0, 2),
+				done(0, 1),
+				failed(0, 0),
+				done(0, 2),
+				{add: true, partition: 0, offset: 0, wantNew: false, wantDispatch: true},
+				done(0, 0, 0, 1, 2),
+			},
+		},
+		{
+			name: "duplicate delivery of an in-flight message is dropped",
+			steps: []offsetStep{
+				received(0, 0), received(0, 1),
+				{add: true, partition: 0, offset: 1, wantNew: false, wantDispatch: false},
+				done(0, 1),
+				{add: true, partition: 0, offset: 1, wantNew: false, wantDispatch: false},
+				done(0, 0, 0, 1),
+			},
+		},
+		{
+			name: "partitions are committed independently",
+			steps: []offsetStep{
+				received(0, 0), received(1, 0), received(0, 1), received(1, 1),
+				done(1, 1),
+				done(0, 0, 0),
+				done(1, 0, 0, 1),
+				done(0, 1, 1),
+			},
+		},
+		{
+			name: "unknown message is ignored",
+			steps: []offsetStep{
+				received(0, 5),
+				done(0, 4),
+				done(1, 5),
+				done(0, 5, 5),
+				done(0, 5),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newOffsetTracker()
+			for i, s := range tt.steps {
+				m := msgAt(s.partition, s.offset)
+				if s.add {
+					isNew, dispatch := tr.add(m)
+					if isNew != s.wantNew || dispatch != s.wantDispatch {
+						t.Fatalf("step %d: add(%d/%d) = (%v, %v), want (%v, %v)",
+							i, s.partition, s.offset, isNew, dispatch, s.wantNew, s.wantDispatch)
+					}
+					continue
+				}
+
+				ready := tr.complete(m, s.ok)
+				for _, r := range ready {
+					if r.Partition != s.partition {
+						t.Fatalf("step %d: completing partition %d released partition %d", i, s.partition, r.Partition)
+					}
+				}
+				if got := offsets(ready); !slices.Equal(got, s.wantReady) {
+					t.Fatalf("step %d: complete(%d/%d, %v) released %v, want %v",
+						i, s.partition, s.offset, s.ok, got, s.wantReady)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64 // доля задержки, которая рандомизируется: 0..1
+}
+
+func NewRetryPolicy(cfg config.Consumer) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    cfg.RetryMaxAttempts,
+		InitialBackoff: cfg.RetryInitialBackoff,
+		MaxBackoff:     cfg.RetryMaxBackoff,
+		Multiplier:     cfg.RetryMultiplier,
+		Jitter:         cfg.RetryJitter,
+	}
+}
+
+// Do вызывает fn, пока она не выполнится успешно, не вернет неретраебельную
+// ошибку или не закончатся попытки. Возвращает число сделанных попыток.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) (int, error) {
+	maxAttempts := max(p.MaxAttempts, 1)
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = fn(ctx); err == nil {
+			return attempt, nil
+		}
+		if !IsRetryable(err) || attempt == maxAttempts {
+			return attempt, err
+		}
+
+		if sleepErr := sleepContext(ctx, p.Backoff(attempt)); sleepErr != nil {
+			return attempt, err
+		}
+	}
+	return maxAttempts, err
+}
+
+// Backoff возвращает задержку перед попыткой attempt+1
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	jitter := min(max(p.Jitter, 0), 1)
+	if jitter > 0 {
+		d = d*(1-jitter) + rand.Float64()*d*jitter
+	}
+	return time.Duration(d)
+}
+
+// IsRetryable отделяет временные ошибки (соединение, таймаут, конфликт
+// сериализации) от постоянных (нарушение ограничений, некорректные данные).
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, db.ErrStaleEvent) ||
+		errors.Is(err, db.ErrOrderNotFound) ||
+		errors.Is(err, db.ErrItemNotFound) ||
+		errors.Is(err, db.ErrInvalidEvent) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return isRetryablePgCode(pgErr.Code)
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+
+	if pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// Неизвестные ошибки считаем временными: лучше повторить, чем потерять заказ
+	return true
+}
+
+func isRetryablePgCode(code string) bool {
+	switch {
+	case code == "40001", // serialization_failure
+		code == "40P01", // deadlock_detected
+		code == "55P03", // lock_not_available
+		code == "57014", // query_canceled
+		code == "57P01", // admin_shutdown
+		code == "57P02", // crash_shutdown
+		code == "57P03": // cannot_connect_now
+		return true
+	case strings.HasPrefix(code, "08"), // connection_exception
+		strings.HasPrefix(code, "53"): // insufficient_resources
+		return true
+	default:
+		// 22 (data_exception), 23 (integrity_constraint_violation) и прочее
+		return false
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type APIKey struct {
+	Name   string
+	Scopes []string
+}
+
+// GetAPIKey ищет неотозванный ключ по SHA-256 хешу (hex)
+func (r *repository) GetAPIKey(ctx context.Context, keyHash string) (*APIKey, error) {
+	var key APIKey
+	err := r.pool.QueryRow(ctx, `
+        SELECT name, scopes FROM api_keys
+        WHERE key_hash = $1 AND revoked_at IS NULL
+    `, keyHash).Scan(&key.Name, &key.Scopes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, classify(fmt.Errorf("get api key: %w", err))
+	}
+	return &key, nil
+}
@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/tracing"
+)
+
+const (
+	bulkOrdersQuery = `
+        SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
+               o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.status, o.version,
+               COALESCE(d.name, ''), COALESCE(d.phone, ''), COALESCE(d.zip, ''), COALESCE(d.city, ''),
+               COALESCE(d.address, ''), COALESCE(d.region, ''), COALESCE(d.email, ''),
+               COALESCE(p.transaction, ''), COALESCE(p.request_id, ''), COALESCE(p.currency, ''),
+               COALESCE(p.provider, ''), COALESCE(p.amount, 0), COALESCE(p.payment_dt, 0),
+               COALESCE(p.bank, ''), COALESCE(p.delivery_cost, 0), COALESCE(p.goods_total, 0),
+               COALESCE(p.custom_fee, 0)
+        FROM orders o
+        LEFT JOIN delivery d ON d.order_uid = o.order_uid
+        LEFT JOIN payment p ON p.order_uid = o.order_uid
+        WHERE o.order_uid = ANY($1)
+    `
+	bulkItemsQuery = `
+        SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price,
+               nm_id, brand, status
+        FROM items
+        WHERE order_uid = ANY($1)
+        ORDER BY order_uid, id
+    `
+)
+
+// LoadOrders загружает заказы двумя запросами независимо от их числа.
+// Заказы без строки delivery или payment возвращаются с пустыми блоками.
+// Порядок результата совпадает с порядком uids; отсутствующие пропускаются.
+func (r *repository) LoadOrders(ctx context.Context, uids []string) (_ []FullOrder, err error) {
+	defer func() { err = classify(err) }()
+	defer metrics.ObserveDB("load_orders", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "db.LoadOrders")
+	defer tracing.End(span, &err)
+
+	if len(uids) == 0 {
+		return []FullOrder{}, nil
+	}
+
+	rows, err := r.pool.Query(ctx, bulkOrdersQuery, uids)
+	if err != nil {
+		return nil, fmt.Errorf("select orders: %w", err)
+	}
+
+	byUID := make(map[string]*FullOrder, len(uids))
+	for rows.Next() {
+		var o FullOrder
+		if err := rows.Scan(
+			&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerID,
+			&o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard, &o.Status, &o.Version,
+			&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City,
+			&o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email,
+			&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency,
+			&o.Payment.Provider, &o.Payment.Amount, &o.Payment.PaymentDT,
+			&o.Payment.Bank, &o.Payment.DeliveryCost, &o.Payment.GoodsTotal,
+			&o.Payment.CustomFee,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan order: %w", err)
+		}
+		byUID[o.OrderUID] = &o
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select orders: %w", err)
+	}
+
+	rows, err = r.pool.Query(ctx, bulkItemsQuery, uids)
+	if err != nil {
+		return nil, fmt.Errorf("select items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderUID string
+		var it Item
+		if err := rows.Scan(
+			&orderUID, &it.ChrtID, &it.TrackNumber, &it.Price, &it.Rid, &it.Name,
+			&it.Sale, &it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status,
+		); err != nil {
+			return nil, fmt.Errorf("scan item: %w", err)
+		}
+		if o, ok := byUID[orderUID]; ok {
+			o.Items = append(o.Items, it)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select items: %w", err)
+	}
+
+	orders := make([]FullOrder, 0, len(byUID))
+	for _, uid := range uids {
+		if o, ok := byUID[uid]; ok {
+			orders = append(orders, *o)
+		}
+	}
+	return orders, nil
+}
+
+type StreamOptions struct {
+	BatchSize int
+	// Limit ограничивает общее число заказов (0 — без ограничения)
+	Limit int
+	// Since отсекает заказы, созданные раньше (нулевое значение — все)
+	Since time.Time
+}
+
+// StreamOrders отдает заказы пачками от самых новых к самым старым
+// (по date_created, затем order_uid). На каждую пачку приходится три запроса.
+// Ошибка из fn прерывает обход и возвращается как есть.
+func (r *repository) StreamOrders(ctx context.Context, opts StreamOptions, fn func(batch []FullOrder) error) error {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	var (
+		after   *orderKey
+		fetched int
+	)
+	for {
+		limit := batchSize
+		if opts.Limit > 0 {
+			limit = min(limit, opts.Limit-fetched)
+			if limit <= 0 {
+				return nil
+			}
+		}
+
+		keys, err := r.orderKeysPage(ctx, after, opts.Since, limit)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		fetched += len(keys)
+
+		uids := make([]string, len(keys))
+		for i, k := range keys {
+			uids[i] = k.orderUID
+		}
+		batch, err := r.LoadOrders(ctx, uids)
+		if err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+
+		if len(keys) < limit {
+			return nil
+		}
+		after = &keys[len(keys)-1]
+	}
+}
+
+type orderKey struct {
+	dateCreated time.Time
+	orderUID    string
+}
+
+func (r *repository) orderKeysPage(ctx context.Context, after *orderKey, since time.Time, limit int) ([]orderKey, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if after != nil {
+		args = append(args, after.dateCreated, after.orderUID)
+		where = append(where, "(date_created, order_uid) < ($1, $2)")
+	}
+	if !since.IsZero() {
+		args = append(args, since)
+		where = append(where, fmt.Sprintf("date_created >= $%d", len(args)))
+	}
+
+	query := "SELECT date_created, order_uid FROM orders"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY date_created DESC, order_uid DESC LIMIT $%d", len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select order keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]orderKey, 0, limit)
+	for rows.Next() {
+		var k orderKey
+		if err := rows.Scan(&k.dateCreated, &k.orderUID); err != nil {
+			return nil, fmt.Errorf("scan order key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
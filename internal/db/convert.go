@@ -0,0 +1,100 @@
+package db
+
+import "github.com/yakovleviga/brokerService/internal/models"
+
+// ToModel переводит заказ из хранилища в каноническую форму models.Order —
+// ту же, что приходит из Kafka и отдается HTTP API.
+func (fo FullOrder) ToModel() models.Order {
+	items := make([]models.Item, len(fo.Items))
+	for i, item := range fo.Items {
+		items[i] = models.Item{
+			ChrtID:      int(item.ChrtID),
+			TrackNumber: item.TrackNumber,
+			Price:       item.Price,
+			Rid:         item.Rid,
+			Name:        item.Name,
+			Sale:        item.Sale,
+			Size:        item.Size,
+			TotalPrice:  item.TotalPrice,
+			NmID:        item.NmID,
+			Brand:       item.Brand,
+			Status:      item.Status,
+		}
+	}
+
+	return models.Order{
+		OrderUID:          fo.OrderUID,
+		TrackNumber:       fo.TrackNumber,
+		Entry:             fo.Entry,
+		Locale:            fo.Locale,
+		InternalSignature: fo.InternalSignature,
+		CustomerID:        fo.CustomerID,
+		DeliveryService:   fo.DeliveryService,
+		ShardKey:          fo.ShardKey,
+		SmID:              fo.SmID,
+		DateCreated:       fo.DateCreated,
+		OofShard:          fo.OofShard,
+		Status:            fo.Status,
+		Version:           fo.Version,
+		Delivery: models.Delivery{
+			Name:    fo.Delivery.Name,
+			Phone:   fo.Delivery.Phone,
+			Zip:     fo.Delivery.Zip,
+			City:    fo.Delivery.City,
+			Address: fo.Delivery.Address,
+			Region:  fo.Delivery.Region,
+			Email:   fo.Delivery.Email,
+		},
+		Payment: models.Payment{
+			Transaction:  fo.Payment.Transaction,
+			RequestID:    fo.Payment.RequestID,
+			Currency:     fo.Payment.Currency,
+			Provider:     fo.Payment.Provider,
+			Amount:       fo.Payment.Amount,
+			PaymentDT:    fo.Payment.PaymentDT,
+			Bank:         fo.Payment.Bank,
+			DeliveryCost: fo.Payment.DeliveryCost,
+			GoodsTotal:   fo.Payment.GoodsTotal,
+			CustomFee:    fo.Payment.CustomFee,
+		},
+		Items: items,
+	}
+}
+
+func FullOrderFromModel(o models.Order) FullOrder {
+	items := make([]Item, len(o.Items))
+	for i, item := range o.Items {
+		items[i] = Item{
+			ChrtID:      int64(item.ChrtID),
+			TrackNumber: item.TrackNumber,
+			Price:       item.Price,
+			Rid:         item.Rid,
+			Name:        item.Name,
+			Sale:        item.Sale,
+			Size:        item.Size,
+			TotalPrice:  item.TotalPrice,
+			NmID:        item.NmID,
+			Brand:       item.Brand,
+			Status:      item.Status,
+		}
+	}
+
+	return FullOrder{
+		OrderUID:          o.OrderUID,
+		TrackNumber:       o.TrackNumber,
+		Entry:             o.Entry,
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerID:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		ShardKey:          o.ShardKey,
+		SmID:              o.SmID,
+		DateCreated:       o.DateCreated,
+		OofShard:          o.OofShard,
+		Status:            o.Status,
+		Version:           o.Version,
+		Delivery:          Delivery(o.Delivery),
+		Payment:           Payment(o.Payment),
+		Items:             items,
+	}
+}
@@ -2,18 +2,25 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 
+	"github.com/yakovleviga/brokerService/internal/metrics"
 	"github.com/yakovleviga/brokerService/internal/models"
-	"log"
+	"github.com/yakovleviga/brokerService/internal/tracing"
+	"log/slog"
+	"time"
 
 	"fmt"
 
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/tracelog"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/yakovleviga/brokerService/internal/config"
@@ -22,7 +29,8 @@ import (
 const (
 	orderQuery = `
         SELECT order_uid, track_number, entry, locale, internal_signature,
-               customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+               customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+               status, version
         FROM orders
         WHERE order_uid = $1
     `
@@ -47,16 +55,33 @@ const (
 
 type repository struct {
 	pool *pgxpool.Pool
+	log  *slog.Logger
 }
 
 type Repository interface {
 	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+	Stat() *pgxpool.Stat
 	GetFullOrder(ctx context.Context, orderUID string) (*FullOrder, error)
-	InsertOrder(ctx context.Context, order models.Order) (err error)
+	InsertOrder(ctx context.Context, order models.Order) (UpsertResult, error)
 	GetAllOrders(ctx context.Context) ([]FullOrder, error)
+	LoadOrders(ctx context.Context, uids []string) ([]FullOrder, error)
+	StreamOrders(ctx context.Context, opts StreamOptions, fn func(batch []FullOrder) error) error
+	ApplyOrderEvent(ctx context.Context, event models.Event) error
+	GetOrderByTrackNumber(ctx context.Context, trackNumber string) (*FullOrder, error)
+	GetOrderByRid(ctx context.Context, rid string) (*FullOrder, error)
+	GetOrderUIDsByCustomerID(ctx context.Context, customerID string, limit int) ([]string, error)
+	GetOrderUIDsByChrtID(ctx context.Context, chrtID int64, limit int) ([]string, error)
+	ListOrders(ctx context.Context, filter OrderFilter) (*OrderPage, error)
+	GetAPIKey(ctx context.Context, keyHash string) (*APIKey, error)
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, ids []int64) error
+	MarkOutboxFailed(ctx context.Context, id int64, cause string, retryAt time.Time) error
 }
 
-func NewRepository(ctx context.Context, cfg config.PostgreSQL) (Repository, error) {
+func NewRepository(ctx context.Context, cfg config.PostgreSQL, log *slog.Logger) (Repository, error) {
+	log = log.With("component", "repository")
+
 	// Формируем строку подключения
 	connString := fmt.Sprintf(
 		`user=%s password=%s host=%s port=%d dbname=%s sslmode=%s 
@@ -78,20 +103,51 @@ func NewRepository(ctx context.Context, cfg config.PostgreSQL) (Repository, erro
 	}
 
 	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheDescribe
+	// SQL-запросы логируем только на уровне debug
+	if log.Enabled(ctx, slog.LevelDebug) {
+		config.ConnConfig.Tracer = &tracelog.TraceLog{
+			Logger: tracelog.LoggerFunc(func(ctx context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
+				// Аргументы запросов содержат PII (имя, телефон, адрес доставки)
+				delete(data, "args")
+				log.Debug(msg, "pgx", data)
+			}),
+			LogLevel: tracelog.LogLevelDebug,
+		}
+	}
 
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create PostgreSQL connection pool")
 	}
 
-	return &repository{pool}, nil
+	return &repository{pool: pool, log: log}, nil
 }
 
 func (r *repository) Ping(ctx context.Context) error {
 	return r.pool.Ping(ctx)
 }
 
-func RunMigrations(cfg config.PostgreSQL) error {
+func (r *repository) Stat() *pgxpool.Stat {
+	return r.pool.Stat()
+}
+
+// Close ждет возврата всех соединений в пул, поэтому вызывается последним
+func (r *repository) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.pool.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func RunMigrations(cfg config.PostgreSQL, log *slog.Logger) error {
 	connStr := fmt.Sprintf(
 		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
 		cfg.User,
@@ -124,14 +180,20 @@ func RunMigrations(cfg config.PostgreSQL) error {
 		return errors.Wrap(err, "migration up failed")
 	}
 
-	log.Println("✅ Migrations applied successfully")
+	version, dirty, _ := m.Version()
+	log.Info("migrations applied", "version", version, "dirty", dirty)
 	return nil
 }
 
-func (r *repository) GetFullOrder(ctx context.Context, orderUID string) (*FullOrder, error) {
+func (r *repository) GetFullOrder(ctx context.Context, orderUID string) (_ *FullOrder, err error) {
+	defer func() { err = classify(err) }()
+	defer metrics.ObserveDB("get_full_order", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "db.GetFullOrder")
+	defer tracing.End(span, &err)
+
 	var order FullOrder
 
-	err := r.pool.QueryRow(ctx, orderQuery, orderUID).Scan(
+	err = r.pool.QueryRow(ctx, orderQuery, orderUID).Scan(
 		&order.OrderUID,
 		&order.TrackNumber,
 		&order.Entry,
@@ -143,7 +205,13 @@ func (r *repository) GetFullOrder(ctx context.Context, orderUID string) (*FullOr
 		&order.SmID,
 		&order.DateCreated,
 		&order.OofShard,
+		&order.Status,
+		&order.Version,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrOrderNotFound
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -157,6 +225,10 @@ func (r *repository) GetFullOrder(ctx context.Context, orderUID string) (*FullOr
 		&order.Delivery.Region,
 		&order.Delivery.Email,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: order %s has no delivery", ErrOrderIncomplete, orderUID)
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -173,6 +245,10 @@ func (r *repository) GetFullOrder(ctx context.Context, orderUID string) (*FullOr
 		&order.Payment.GoodsTotal,
 		&order.Payment.CustomFee,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("%w: order %s has no payment", ErrOrderIncomplete, orderUID)
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -209,10 +285,30 @@ func (r *repository) GetFullOrder(ctx context.Context, orderUID string) (*FullOr
 	return &order, nil
 }
 
-func (r *repository) InsertOrder(ctx context.Context, order models.Order) (err error) {
+// InsertOrder идемпотентно сохраняет заказ: повторная доставка того же payload
+// ничего не меняет, а измененный заказ целиком заменяет delivery, payment и items.
+// Созданный или измененный заказ в той же транзакции ставит в outbox событие
+// order.persisted.
+func (r *repository) InsertOrder(ctx context.Context, order models.Order) (result UpsertResult, err error) {
+	defer metrics.ObserveDB("insert_order", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "db.InsertOrder")
+	defer tracing.End(span, &err)
+
+	hash, err := payloadHash(order)
+	if err != nil {
+		return "", err
+	}
+
+	status := order.Status
+	if status == "" {
+		status = models.OrderStatusCreated
+	}
+	// Снимок в outbox должен совпадать с тем, что сохранено
+	order.Status = status
+
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("start transaction: %w", err)
+		return "", fmt.Errorf("start transaction: %w", err)
 	}
 
 	defer func() {
@@ -223,11 +319,31 @@ func (r *repository) InsertOrder(ctx context.Context, order models.Order) (err e
 		}
 	}()
 
-	_, err = tx.Exec(ctx, `
+	var inserted bool
+	err = tx.QueryRow(ctx, `
         INSERT INTO orders (
             order_uid, track_number, entry, locale, internal_signature, customer_id,
-            delivery_service, shardkey, sm_id, date_created, oof_shard
-        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+            delivery_service, shardkey, sm_id, date_created, oof_shard, status, version,
+            payload_hash, updated_at
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,now())
+        ON CONFLICT (order_uid) DO UPDATE SET
+            track_number       = EXCLUDED.track_number,
+            entry              = EXCLUDED.entry,
+            locale             = EXCLUDED.locale,
+            internal_signature = EXCLUDED.internal_signature,
+            customer_id        = EXCLUDED.customer_id,
+            delivery_service   = EXCLUDED.delivery_service,
+            shardkey           = EXCLUDED.shardkey,
+            sm_id              = EXCLUDED.sm_id,
+            date_created       = EXCLUDED.date_created,
+            oof_shard          = EXCLUDED.oof_shard,
+            status             = EXCLUDED.status,
+            version            = EXCLUDED.version,
+            payload_hash       = EXCLUDED.payload_hash,
+            updated_at         = now()
+        WHERE orders.payload_hash IS DISTINCT FROM EXCLUDED.payload_hash
+          AND orders.version <= EXCLUDED.version
+        RETURNING (xmax = 0) AS inserted
     `,
 		order.OrderUID,
 		order.TrackNumber,
@@ -240,9 +356,36 @@ func (r *repository) InsertOrder(ctx context.Context, order models.Order) (err e
 		order.SmID,
 		order.DateCreated,
 		order.OofShard,
-	)
+		status,
+		order.Version,
+		hash,
+	).Scan(&inserted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Строка уже есть: либо payload не изменился, либо снимок устарел
+		var storedHash *string
+		err = tx.QueryRow(ctx, `SELECT payload_hash FROM orders WHERE order_uid = $1`, order.OrderUID).
+			Scan(&storedHash)
+		if err != nil {
+			return "", fmt.Errorf("select order hash: %w", err)
+		}
+		if storedHash != nil && *storedHash == hash {
+			return UpsertUnchanged, nil
+		}
+		err = ErrStaleEvent
+		return "", err
+	}
 	if err != nil {
-		return fmt.Errorf("insert orders: %w", err)
+		return "", fmt.Errorf("upsert orders: %w", err)
+	}
+
+	result = UpsertCreated
+	if !inserted {
+		result = UpsertUpdated
+		for _, table := range []string{"delivery", "payment", "items"} {
+			if _, err = tx.Exec(ctx, "DELETE FROM "+table+" WHERE order_uid = $1", order.OrderUID); err != nil {
+				return "", fmt.Errorf("delete %s: %w", table, err)
+			}
+		}
 	}
 
 	_, err = tx.Exec(ctx, `
@@ -260,7 +403,7 @@ func (r *repository) InsertOrder(ctx context.Context, order models.Order) (err e
 		order.Delivery.Email,
 	)
 	if err != nil {
-		return fmt.Errorf("insert delivery: %w", err)
+		return "", fmt.Errorf("insert delivery: %w", err)
 	}
 
 	_, err = tx.Exec(ctx, `
@@ -282,7 +425,7 @@ func (r *repository) InsertOrder(ctx context.Context, order models.Order) (err e
 		order.Payment.CustomFee,
 	)
 	if err != nil {
-		return fmt.Errorf("insert payment: %w", err)
+		return "", fmt.Errorf("insert payment: %w", err)
 	}
 
 	for _, item := range order.Items {
@@ -306,78 +449,34 @@ func (r *repository) InsertOrder(ctx context.Context, order models.Order) (err e
 			item.Status,
 		)
 		if err != nil {
-			return fmt.Errorf("insert item: %w", err)
+			return "", fmt.Errorf("insert item: %w", err)
 		}
 	}
 
-	return nil
-}
+	if err = insertOrderPersisted(ctx, tx, order, result); err != nil {
+		return "", err
+	}
 
-func (r *repository) GetAllOrders(ctx context.Context) ([]FullOrder, error) {
+	return result, nil
+}
 
-	rows, err := r.pool.Query(ctx, `
-SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
-       o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
-       d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-       pay.transaction, pay.request_id, pay.currency, pay.provider, pay.amount,
-       pay.payment_dt, pay.bank, pay.delivery_cost, pay.goods_total, pay.custom_fee
-FROM orders o
-JOIN delivery d ON o.order_uid = d.order_uid
-JOIN payment pay ON o.order_uid = pay.order_uid
-`)
+func payloadHash(order models.Order) (string, error) {
+	payload, err := json.Marshal(order)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("marshal order: %w", err)
 	}
-	defer rows.Close()
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
 
+func (r *repository) GetAllOrders(ctx context.Context) ([]FullOrder, error) {
 	var orders []FullOrder
-
-	for rows.Next() {
-		var o FullOrder
-		var d Delivery
-		var pmt Payment
-
-		err := rows.Scan(
-			&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerID,
-			&o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard,
-			&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email,
-			&pmt.Transaction, &pmt.RequestID, &pmt.Currency, &pmt.Provider, &pmt.Amount,
-			&pmt.PaymentDT, &pmt.Bank, &pmt.DeliveryCost, &pmt.GoodsTotal, &pmt.CustomFee,
-		)
-		if err != nil {
-			return nil, err
-		}
-		o.Delivery = d
-		o.Payment = pmt
-
-		itemRows, err := r.pool.Query(ctx, `
-SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
-FROM items
-WHERE order_uid = $1
-`, o.OrderUID)
-		if err != nil {
-			return nil, err
-		}
-
-		var items []Item
-		for itemRows.Next() {
-			var it Item
-			err := itemRows.Scan(
-				&it.ChrtID, &it.TrackNumber, &it.Price, &it.Rid, &it.Name,
-				&it.Sale, &it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status,
-			)
-			if err != nil {
-				itemRows.Close()
-				return nil, err
-			}
-			items = append(items, it)
-		}
-		itemRows.Close()
-
-		o.Items = items
-
-		orders = append(orders, o)
+	err := r.StreamOrders(ctx, StreamOptions{}, func(batch []FullOrder) error {
+		orders = append(orders, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	return orders, nil
 }
@@ -2,6 +2,14 @@ package db
 
 import "time"
 
+type UpsertResult string
+
+const (
+	UpsertCreated   UpsertResult = "created"
+	UpsertUpdated   UpsertResult = "updated"
+	UpsertUnchanged UpsertResult = "unchanged"
+)
+
 type Delivery struct {
 	Name    string
 	Phone   string
@@ -51,6 +59,8 @@ type FullOrder struct {
 	SmID              int
 	DateCreated       time.Time
 	OofShard          string
+	Status            string
+	Version           int64
 
 	Delivery Delivery
 	Payment  Payment
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrOrderNotFound  = errors.New("order not found")
+	ErrItemNotFound   = errors.New("order item not found")
+	ErrInvalidEvent   = errors.New("invalid order event")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrStaleEvent — событие старее (или той же версии), что уже сохранено
+	ErrStaleEvent = errors.New("stale order event")
+	// ErrOrderIncomplete — строка заказа есть, но нет delivery или payment
+	ErrOrderIncomplete = errors.New("order is incomplete")
+	// ErrUnavailable — БД недоступна, перегружена или не ответила вовремя;
+	// запрос можно повторить позже
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// classify помечает ошибки соединения, таймауты и нехватку ресурсов как
+// ErrUnavailable, сохраняя исходную ошибку в цепочке.
+func classify(err error) error {
+	if err == nil || errors.Is(err, ErrUnavailable) || !unavailable(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
+
+func unavailable(err error) bool {
+	// Отмену запроса клиентом недоступностью БД не считаем
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	// В том числе ожидание свободного соединения в исчерпанном пуле
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"), // connection_exception
+			strings.HasPrefix(pgErr.Code, "53"), // insufficient_resources
+			pgErr.Code == "57P01",               // admin_shutdown
+			pgErr.Code == "57P02",               // crash_shutdown
+			pgErr.Code == "57P03":               // cannot_connect_now
+			return true
+		}
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
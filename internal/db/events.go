@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/models"
+	"github.com/yakovleviga/brokerService/internal/tracing"
+)
+
+// ApplyOrderEvent применяет к сохраненному заказу событие изменения.
+// Событие с версией не новее сохраненной отклоняется с ErrStaleEvent.
+// Создание заказа (order.created) идет через InsertOrder.
+func (r *repository) ApplyOrderEvent(ctx context.Context, event models.Event) (err error) {
+	defer metrics.ObserveDB("apply_order_event", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "db.ApplyOrderEvent")
+	defer tracing.End(span, &err)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		} else {
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if err = bumpOrderVersion(ctx, tx, event); err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case models.EventOrderStatusChanged:
+		var payload models.OrderStatusChanged
+		if err = decodePayload(event, &payload); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE orders SET status = $2 WHERE order_uid = $1`,
+			event.OrderUID, payload.Status)
+		if err != nil {
+			return fmt.Errorf("update order status: %w", err)
+		}
+
+	case models.EventItemStatusChanged:
+		var payload models.ItemStatusChanged
+		if err = decodePayload(event, &payload); err != nil {
+			return err
+		}
+		tag, execErr := tx.Exec(ctx, `UPDATE items SET status = $3 WHERE order_uid = $1 AND chrt_id = $2`,
+			event.OrderUID, payload.ChrtID, payload.Status)
+		if execErr != nil {
+			err = fmt.Errorf("update item status: %w", execErr)
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			err = errors.Wrapf(ErrItemNotFound, "chrt_id %d", payload.ChrtID)
+			return err
+		}
+
+	case models.EventDeliveryUpdated:
+		var payload models.Delivery
+		if err = decodePayload(event, &payload); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+            INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
+            VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+            ON CONFLICT (order_uid) DO UPDATE SET
+                name = EXCLUDED.name, phone = EXCLUDED.phone, zip = EXCLUDED.zip,
+                city = EXCLUDED.city, address = EXCLUDED.address,
+                region = EXCLUDED.region, email = EXCLUDED.email
+        `,
+			event.OrderUID,
+			payload.Name,
+			payload.Phone,
+			payload.Zip,
+			payload.City,
+			payload.Address,
+			payload.Region,
+			payload.Email,
+		)
+		if err != nil {
+			return fmt.Errorf("update delivery: %w", err)
+		}
+
+	case models.EventOrderCancelled:
+		var payload models.OrderCancelled
+		if len(event.Payload) > 0 {
+			if err = decodePayload(event, &payload); err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec(ctx, `
+            UPDATE orders SET status = $2, cancel_reason = $3, cancelled_at = $4
+            WHERE order_uid = $1
+        `, event.OrderUID, models.OrderStatusCancelled, payload.Reason, event.OccurredAt)
+		if err != nil {
+			return fmt.Errorf("cancel order: %w", err)
+		}
+
+	default:
+		err = errors.Wrapf(ErrInvalidEvent, "unsupported event type %q", event.Type)
+		return err
+	}
+
+	// Изменение уходит получателям тем же событием, что пришло
+	return insertOutbox(ctx, tx, event)
+}
+
+// bumpOrderVersion поднимает версию заказа, если событие новее сохраненного
+// состояния. Строка заказа остается заблокированной до конца транзакции.
+func bumpOrderVersion(ctx context.Context, tx pgx.Tx, event models.Event) error {
+	tag, err := tx.Exec(ctx, `
+        UPDATE orders SET version = $2, updated_at = now()
+        WHERE order_uid = $1 AND version < $2
+    `, event.OrderUID, event.Version)
+	if err != nil {
+		return fmt.Errorf("update order version: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = $1)`, event.OrderUID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check order exists: %w", err)
+	}
+	if !exists {
+		return errors.Wrapf(ErrOrderNotFound, "order %s", event.OrderUID)
+	}
+	return errors.Wrapf(ErrStaleEvent, "order %s version %d", event.OrderUID, event.Version)
+}
+
+func decodePayload(event models.Event, v any) error {
+	if err := json.Unmarshal(event.Payload, v); err != nil {
+		return errors.Wrapf(ErrInvalidEvent, "decode %s payload: %v", event.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/tracing"
+)
+
+type SortField string
+
+const (
+	SortByDateCreated SortField = "date_created"
+	SortByOrderUID    SortField = "order_uid"
+	SortByAmount      SortField = "amount"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type OrderFilter struct {
+	CustomerID      string
+	DeliveryService string
+	CreatedFrom     time.Time
+	CreatedTo       time.Time
+	Provider        string
+	Bank            string
+	Currency        string
+	Locale          string
+	Brand           string
+
+	SortBy   SortField
+	SortDesc bool
+	Limit    int
+	Cursor   string
+}
+
+type OrderPage struct {
+	Orders     []FullOrder
+	NextCursor string
+}
+
+// cursor — позиция keyset-пагинации: значение поля сортировки последней
+// строки страницы и ее order_uid для однозначного порядка. Сортировка, для
+// которой выдан курсор, тоже хранится в нем: с другой он не имеет смысла.
+type cursor struct {
+	SortBy      SortField `json:"s"`
+	SortDesc    bool      `json:"r,omitempty"`
+	DateCreated time.Time `json:"d,omitempty"`
+	Amount      int       `json:"a,omitempty"`
+	OrderUID    string    `json:"u"`
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.OrderUID == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (r *repository) ListOrders(ctx context.Context, f OrderFilter) (_ *OrderPage, err error) {
+	defer func() { err = classify(err) }()
+	defer metrics.ObserveDB("list_orders", time.Now(), &err)
+	ctx, span := tracing.Start(ctx, "db.ListOrders")
+	defer tracing.End(span, &err)
+
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.CustomerID != "" {
+		where = append(where, "o.customer_id = "+arg(f.CustomerID))
+	}
+	if f.DeliveryService != "" {
+		where = append(where, "o.delivery_service = "+arg(f.DeliveryService))
+	}
+	if !f.CreatedFrom.IsZero() {
+		where = append(where, "o.date_created >= "+arg(f.CreatedFrom))
+	}
+	if !f.CreatedTo.IsZero() {
+		where = append(where, "o.date_created < "+arg(f.CreatedTo))
+	}
+	if f.Locale != "" {
+		where = append(where, "o.locale = "+arg(f.Locale))
+	}
+	if f.Provider != "" {
+		where = append(where, "p.provider = "+arg(f.Provider))
+	}
+	if f.Bank != "" {
+		where = append(where, "p.bank = "+arg(f.Bank))
+	}
+	if f.Currency != "" {
+		where = append(where, "p.currency = "+arg(f.Currency))
+	}
+	if f.Brand != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.brand = "+arg(f.Brand)+")")
+	}
+
+	// Колонки сортировки NOT NULL (миграция 0008) и совпадают с индексами
+	// из 0005, поэтому страница читается по индексу без сортировки всей выборки
+	sortColumn, uidColumn, join := "o.date_created", "o.order_uid", "LEFT JOIN"
+	switch f.SortBy {
+	case "", SortByDateCreated:
+		f.SortBy = SortByDateCreated
+	case SortByOrderUID:
+		sortColumn = ""
+	case SortByAmount:
+		// Заказ без payment неполон и в сортировку по сумме не попадает
+		sortColumn, uidColumn, join = "p.amount", "p.order_uid", "JOIN"
+	default:
+		return nil, errors.Errorf("unsupported sort field %q", f.SortBy)
+	}
+
+	op, dir := ">", "ASC"
+	if f.SortDesc {
+		op, dir = "<", "DESC"
+	}
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.SortBy != f.SortBy || c.SortDesc != f.SortDesc {
+			return nil, errors.Wrap(ErrInvalidCursor, "cursor was issued for a different sort")
+		}
+		switch f.SortBy {
+		case SortByDateCreated:
+			where = append(where, fmt.Sprintf("(%s, %s) %s (%s, %s)", sortColumn, uidColumn, op, arg(c.DateCreated), arg(c.OrderUID)))
+		case SortByAmount:
+			where = append(where, fmt.Sprintf("(%s, %s) %s (%s, %s)", sortColumn, uidColumn, op, arg(c.Amount), arg(c.OrderUID)))
+		case SortByOrderUID:
+			where = append(where, fmt.Sprintf("o.order_uid %s %s", op, arg(c.OrderUID)))
+		}
+	}
+
+	orderBy := fmt.Sprintf("o.order_uid %s", dir)
+	if sortColumn != "" {
+		orderBy = fmt.Sprintf("%s %s, %s %s", sortColumn, dir, uidColumn, dir)
+	}
+
+	query := `
+        SELECT o.order_uid, o.date_created, COALESCE(p.amount, 0)
+        FROM orders o
+        ` + join + ` payment p ON p.order_uid = o.order_uid`
+	if len(where) > 0 {
+		query += "\n        WHERE " + strings.Join(where, "\n          AND ")
+	}
+	// Берем на одну строку больше, чтобы понять, есть ли следующая страница
+	query += "\n        ORDER BY " + orderBy + "\n        LIMIT " + arg(f.Limit+1)
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []cursor
+	for rows.Next() {
+		var c cursor
+		if err := rows.Scan(&c.OrderUID, &c.DateCreated, &c.Amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{}
+	if len(keys) > f.Limit {
+		keys = keys[:f.Limit]
+		next := keys[len(keys)-1]
+		next.SortBy, next.SortDesc = f.SortBy, f.SortDesc
+		page.NextCursor = encodeCursor(next)
+	}
+
+	uids := make([]string, len(keys))
+	for i, k := range keys {
+		uids[i] = k.OrderUID
+	}
+	if page.Orders, err = r.LoadOrders(ctx, uids); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
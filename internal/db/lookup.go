@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *repository) GetOrderByTrackNumber(ctx context.Context, trackNumber string) (_ *FullOrder, err error) {
+	defer func() { err = classify(err) }()
+
+	var orderUID string
+	err = r.pool.QueryRow(ctx, `
+        SELECT order_uid FROM orders
+        WHERE track_number = $1
+        ORDER BY date_created DESC
+        LIMIT 1
+    `, trackNumber).Scan(&orderUID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.GetFullOrder(ctx, orderUID)
+}
+
+func (r *repository) GetOrderByRid(ctx context.Context, rid string) (_ *FullOrder, err error) {
+	defer func() { err = classify(err) }()
+
+	var orderUID string
+	err = r.pool.QueryRow(ctx, `SELECT order_uid FROM items WHERE rid = $1 LIMIT 1`, rid).Scan(&orderUID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.GetFullOrder(ctx, orderUID)
+}
+
+// GetOrderUIDsByCustomerID возвращает order_uid заказов покупателя, новые первыми
+func (r *repository) GetOrderUIDsByCustomerID(ctx context.Context, customerID string, limit int) ([]string, error) {
+	return r.queryOrderUIDs(ctx, `
+        SELECT order_uid FROM orders
+        WHERE customer_id = $1
+        ORDER BY date_created DESC
+        LIMIT $2
+    `, customerID, limit)
+}
+
+// GetOrderUIDsByChrtID возвращает order_uid заказов с товаром chrtID, новые первыми
+func (r *repository) GetOrderUIDsByChrtID(ctx context.Context, chrtID int64, limit int) ([]string, error) {
+	return r.queryOrderUIDs(ctx, `
+        SELECT o.order_uid FROM orders o
+        WHERE EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.chrt_id = $1)
+        ORDER BY o.date_created DESC
+        LIMIT $2
+    `, chrtID, limit)
+}
+
+func (r *repository) queryOrderUIDs(ctx context.Context, query string, args ...any) (_ []string, err error) {
+	defer func() { err = classify(err) }()
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
@@ -0,0 +1,6 @@
+-- +migrate Up
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payload_hash VARCHAR;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS items_order_uid_idx ON items (order_uid);
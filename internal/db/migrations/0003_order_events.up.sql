@@ -0,0 +1,6 @@
+-- +migrate Up
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'created';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancel_reason VARCHAR;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
@@ -0,0 +1,6 @@
+-- +migrate Up
+
+CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id, date_created DESC);
+CREATE INDEX IF NOT EXISTS items_rid_idx ON items (rid);
+CREATE INDEX IF NOT EXISTS items_chrt_id_idx ON items (chrt_id);
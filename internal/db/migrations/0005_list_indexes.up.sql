@@ -0,0 +1,9 @@
+-- +migrate Up
+
+CREATE INDEX IF NOT EXISTS orders_date_created_uid_idx ON orders (date_created, order_uid);
+CREATE INDEX IF NOT EXISTS orders_delivery_service_idx ON orders (delivery_service, date_created, order_uid);
+CREATE INDEX IF NOT EXISTS payment_amount_idx ON payment (amount, order_uid);
+CREATE INDEX IF NOT EXISTS payment_provider_idx ON payment (provider);
+CREATE INDEX IF NOT EXISTS payment_bank_idx ON payment (bank);
+CREATE INDEX IF NOT EXISTS payment_currency_idx ON payment (currency);
+CREATE INDEX IF NOT EXISTS items_brand_idx ON items (brand, order_uid);
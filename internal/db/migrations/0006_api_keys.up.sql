@@ -0,0 +1,10 @@
+-- +migrate Up
+
+-- Храним только SHA-256 от ключа: сам ключ показывается клиенту один раз при выдаче
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_hash   TEXT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    scopes     TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
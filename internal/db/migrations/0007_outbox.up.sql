@@ -0,0 +1,18 @@
+-- +migrate Up
+
+-- Исходящие события пишутся в одной транзакции с заказом и публикуются
+-- relay'ем (internal/outbox) с гарантией at-least-once
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    aggregate_id    TEXT NOT NULL,
+    event_type      TEXT NOT NULL,
+    version         BIGINT NOT NULL DEFAULT 0,
+    payload         JSONB NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts        INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT,
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (next_attempt_at, id) WHERE sent_at IS NULL;
@@ -0,0 +1,14 @@
+-- +migrate Up
+
+-- Ключи keyset-пагинации не должны быть NULL: сравнение (NULL, uid) > (...)
+-- ложно, и такие строки выпадают из страниц. Без COALESCE в ORDER BY
+-- сортировка идет по индексам из 0005.
+UPDATE payment SET amount = 0 WHERE amount IS NULL;
+ALTER TABLE payment
+    ALTER COLUMN amount SET DEFAULT 0,
+    ALTER COLUMN amount SET NOT NULL;
+
+UPDATE orders SET date_created = 'epoch' WHERE date_created IS NULL;
+ALTER TABLE orders
+    ALTER COLUMN date_created SET DEFAULT now(),
+    ALTER COLUMN date_created SET NOT NULL;
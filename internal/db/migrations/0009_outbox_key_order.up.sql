@@ -0,0 +1,5 @@
+-- +migrate Up
+
+-- Relay забирает событие заказа, только если до него нет неотправленных
+-- событий того же заказа
+CREATE INDEX IF NOT EXISTS outbox_aggregate_pending_idx ON outbox (aggregate_id, id) WHERE sent_at IS NULL;
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+type OutboxMessage struct {
+	ID          int64
+	AggregateID string
+	EventType   string
+	Version     int64
+	Payload     json.RawMessage
+	CreatedAt   time.Time
+	Attempts    int
+}
+
+// insertOrderPersisted добавляет событие order.persisted в транзакции сохранения заказа
+func insertOrderPersisted(ctx context.Context, tx pgx.Tx, order models.Order, result UpsertResult) error {
+	payload, err := json.Marshal(models.OrderPersisted{Result: string(result), Order: order})
+	if err != nil {
+		return fmt.Errorf("marshal outbox payload: %w", err)
+	}
+	return insertOutbox(ctx, tx, models.Event{
+		Type:     models.EventOrderPersisted,
+		OrderUID: order.OrderUID,
+		Version:  order.Version,
+		Payload:  payload,
+	})
+}
+
+// insertOutbox добавляет событие в outbox в текущей транзакции
+func insertOutbox(ctx context.Context, tx pgx.Tx, event models.Event) error {
+	payload := []byte(event.Payload)
+	if len(payload) == 0 {
+		payload = []byte(`{}`)
+	}
+
+	_, err := tx.Exec(ctx, `
+        INSERT INTO outbox (aggregate_id, event_type, version, payload)
+        VALUES ($1, $2, $3, $4)
+    `, event.OrderUID, event.Type, event.Version, payload)
+	if err != nil {
+		return fmt.Errorf("insert outbox: %w", err)
+	}
+	return nil
+}
+
+// ClaimOutbox забирает до limit готовых к отправке событий и откладывает их
+// следующую попытку на lease: если relay упадет, не отметив события, их
+// подхватит следующий проход. Параллельные relay'и не получат одни и те же строки.
+// У каждого заказа забирается только самое раннее неотправленное событие:
+// пока оно не отправлено, более поздние ждут, и порядок по order_uid сохраняется.
+func (r *repository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) (_ []OutboxMessage, err error) {
+	defer func() { err = classify(err) }()
+
+	rows, err := r.pool.Query(ctx, `
+        UPDATE outbox o
+        SET attempts = o.attempts + 1,
+            next_attempt_at = now() + $2 * interval '1 millisecond'
+        FROM (
+            SELECT c.id FROM outbox c
+            WHERE c.sent_at IS NULL AND c.next_attempt_at <= now()
+              AND NOT EXISTS (
+                  SELECT 1 FROM outbox e
+                  WHERE e.aggregate_id = c.aggregate_id AND e.sent_at IS NULL AND e.id < c.id
+              )
+            ORDER BY c.id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        ) pending
+        WHERE o.id = pending.id
+        RETURNING o.id, o.aggregate_id, o.event_type, o.version, o.payload, o.created_at, o.attempts
+    `, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox: %w", err)
+	}
+
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxMessage, error) {
+		var m OutboxMessage
+		err := row.Scan(&m.ID, &m.AggregateID, &m.EventType, &m.Version, &m.Payload, &m.CreatedAt, &m.Attempts)
+		return m, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan outbox: %w", err)
+	}
+
+	// RETURNING не гарантирует порядок, а публиковать нужно в порядке записи
+	slices.SortFunc(messages, func(a, b OutboxMessage) int { return cmp.Compare(a.ID, b.ID) })
+	return messages, nil
+}
+
+func (r *repository) MarkOutboxSent(ctx context.Context, ids []int64) error {
+	_, err := r.pool.Exec(ctx, `UPDATE outbox SET sent_at = now(), last_error = NULL WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return classify(fmt.Errorf("mark outbox sent: %w", err))
+	}
+	return nil
+}
+
+func (r *repository) MarkOutboxFailed(ctx context.Context, id int64, cause string, retryAt time.Time) error {
+	_, err := r.pool.Exec(ctx, `UPDATE outbox SET last_error = $2, next_attempt_at = $3 WHERE id = $1`, id, cause, retryAt)
+	if err != nil {
+		return classify(fmt.Errorf("mark outbox failed: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// Check — проверка одной зависимости. Падение критичной проверки выводит
+// сервис из балансировки (down), некритичной — только помечает его degraded.
+type Check struct {
+	Name     string
+	Critical bool
+	Timeout  time.Duration
+	Fn       func(ctx context.Context) error
+	// Details — необязательные подробности для ответа (например, прогресс прогрева)
+	Details func() any
+}
+
+type Result struct {
+	Name        string     `json:"name"`
+	Status      Status     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LatencyMs   float64    `json:"latency_ms"`
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Details     any        `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status    Status    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+type lastError struct {
+	message string
+	at      time.Time
+}
+
+type Checker struct {
+	defaultTimeout time.Duration
+
+	mu         sync.Mutex
+	checks     []Check
+	lastErrors map[string]lastError
+}
+
+func NewChecker(defaultTimeout time.Duration) *Checker {
+	return &Checker{
+		defaultTimeout: defaultTimeout,
+		lastErrors:     make(map[string]lastError),
+	}
+}
+
+func (h *Checker) Register(check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check)
+}
+
+// Run выполняет все проверки параллельно
+func (h *Checker) Run(ctx context.Context) Report {
+	h.mu.Lock()
+	checks := append([]Check(nil), h.checks...)
+	h.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = h.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, CheckedAt: time.Now(), Checks: results}
+	for _, r := range results {
+		if r.Status == StatusUp {
+			continue
+		}
+		if r.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (h *Checker) run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = h.defaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Fn(ctx)
+	latency := time.Since(start)
+
+	result := Result{
+		Name:      check.Name,
+		Status:    StatusUp,
+		Critical:  check.Critical,
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+	}
+	if check.Details != nil {
+		result.Details = check.Details()
+	}
+
+	h.mu.Lock()
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+		h.lastErrors[check.Name] = lastError{message: err.Error(), at: time.Now()}
+	}
+	if last, ok := h.lastErrors[check.Name]; ok {
+		result.LastError = last.message
+		result.LastErrorAt = &last.at
+	}
+	h.mu.Unlock()
+
+	return result
+}
+
+// Liveness — GET /healthz: процесс жив и обслуживает запросы. Зависимости
+// здесь не проверяются, чтобы сбой БД не приводил к рестарту пода.
+func (h *Checker) Liveness(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": StatusUp})
+}
+
+// Readiness — GET /readyz: 503, только если упала критичная зависимость
+func (h *Checker) Readiness(c *fiber.Ctx) error {
+	report := h.Run(c.Context())
+	if report.Status == StatusDown {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(report)
+	}
+	return c.JSON(report)
+}
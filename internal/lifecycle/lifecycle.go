@@ -0,0 +1,59 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager выполняет шаги остановки строго по порядку регистрации,
+// укладываясь в общий дедлайн.
+type Manager struct {
+	log     *slog.Logger
+	timeout time.Duration
+	hooks   []hook
+}
+
+func NewManager(timeout time.Duration, log *slog.Logger) *Manager {
+	return &Manager{timeout: timeout, log: log.With("component", "lifecycle")}
+}
+
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Shutdown возвращает ошибку, если какой-то шаг завершился с ошибкой или
+// остановка не уложилась в дедлайн. Шаги после превышения дедлайна не ждем.
+func (m *Manager) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var errs []error
+	for _, h := range m.hooks {
+		start := time.Now()
+		done := make(chan error, 1)
+		go func() { done <- h.fn(ctx) }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+				m.log.Error("shutdown step failed", "step", h.name, "duration", time.Since(start).String(), "error", err)
+				continue
+			}
+			m.log.Info("shutdown step done", "step", h.name, "duration", time.Since(start).String())
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("%s: shutdown deadline of %s exceeded", h.name, m.timeout))
+			return errors.Join(errs...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type ctxKey struct{}
+
+// New создает логгер из LOG_LEVEL и LOG_FORMAT: JSON для продакшена,
+// текст для локального запуска.
+func New(level, format string) *slog.Logger {
+	return NewWithWriter(os.Stdout, level, format)
+}
+
+func NewWithWriter(w io.Writer, level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(handler)
+}
+
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// WithContext кладет логгер с полями запроса (request_id и т.п.) в контекст
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext достает логгер запроса, а если его нет — возвращает fallback
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+// Kafka адаптирует slog к логгеру kafka-go. Внутренние сообщения reader'а
+// слишком подробные, поэтому идут на debug, ошибки — на error.
+func Kafka(l *slog.Logger, level slog.Level) kafka.LoggerFunc {
+	return func(msg string, args ...any) {
+		l.Log(context.Background(), level, "kafka: "+fmt.Sprintf(msg, args...))
+	}
+}
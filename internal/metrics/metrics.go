@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "orders"
+
+var (
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_consumed_total",
+		Help:      "Messages fetched from the broker.",
+	}, []string{"partition"})
+
+	MessagesParsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_parsed_total",
+		Help:      "Messages successfully decoded into an order event.",
+	}, []string{"partition"})
+
+	MessagesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_rejected_total",
+		Help:      "Messages sent to the DLQ or quarantine, or dropped as stale, by stage.",
+	}, []string{"partition", "stage"})
+
+	MessagesPersisted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_persisted_total",
+		Help:      "Messages applied to the database, by upsert result or event type.",
+	}, []string{"partition", "result"})
+
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "lag_messages",
+		Help:      "Difference between the partition high watermark and the last fetched offset.",
+	}, []string{"partition"})
+
+	ConsumerInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "messages_in_flight",
+		Help:      "Messages fetched from the broker but not yet acknowledged.",
+	})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "repository",
+		Name:      "query_duration_seconds",
+		Help:      "Repository operation latency.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	OutboxPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "published_total",
+		Help:      "Outbox events published to the broker.",
+	})
+
+	OutboxFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "publish_failures_total",
+		Help:      "Outbox events that failed to publish and were rescheduled.",
+	})
+
+	HTTPRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected with 429 by route group.",
+	}, []string{"group"})
+)
+
+func Partition(p int) string {
+	return strconv.Itoa(p)
+}
+
+// ObserveDB используется как defer metrics.ObserveDB("insert_order", time.Now(), &err)
+func ObserveDB(operation string, start time.Time, err *error) {
+	status := "ok"
+	if err != nil && *err != nil {
+		status = "error"
+	}
+	DBQueryDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
+
+// RegisterPool публикует статистику пула pgx
+func RegisterPool(stat func() *pgxpool.Stat) {
+	prometheus.MustRegister(&poolCollector{stat: stat})
+}
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(namespace+"_pgx_pool_acquired_conns", "Connections currently in use.", nil, nil)
+	poolIdleConns     = prometheus.NewDesc(namespace+"_pgx_pool_idle_conns", "Idle connections.", nil, nil)
+	poolTotalConns    = prometheus.NewDesc(namespace+"_pgx_pool_total_conns", "Total connections.", nil, nil)
+	poolMaxConns      = prometheus.NewDesc(namespace+"_pgx_pool_max_conns", "Maximum pool size.", nil, nil)
+	poolAcquireCount  = prometheus.NewDesc(namespace+"_pgx_pool_acquire_total", "Successful connection acquires.", nil, nil)
+	poolAcquireWait   = prometheus.NewDesc(namespace+"_pgx_pool_acquire_wait_seconds_total", "Time spent waiting for a connection.", nil, nil)
+	poolEmptyAcquire  = prometheus.NewDesc(namespace+"_pgx_pool_empty_acquire_total", "Acquires that had to wait for a connection.", nil, nil)
+)
+
+type poolCollector struct {
+	stat func() *pgxpool.Stat
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredConns
+	ch <- poolIdleConns
+	ch <- poolTotalConns
+	ch <- poolMaxConns
+	ch <- poolAcquireCount
+	ch <- poolAcquireWait
+	ch <- poolEmptyAcquire
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireCount, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireWait, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquire, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+}
+
+// Middleware замеряет длительность HTTP-запросов. Маршрут берется из шаблона
+// (/v1/orders/:order_uid), чтобы не плодить метки на каждый ID.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			if fe, ok := err.(*fiber.Error); ok {
+				status = fe.Code
+			} else {
+				status = fiber.StatusInternalServerError
+			}
+		}
+
+		HTTPRequestDuration.
+			WithLabelValues(c.Method(), c.Route().Path, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
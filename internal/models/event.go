@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventOrderCreated       EventType = "order.created"
+	EventOrderStatusChanged EventType = "order.status_changed"
+	EventItemStatusChanged  EventType = "order.item_status_changed"
+	EventDeliveryUpdated    EventType = "order.delivery_updated"
+	EventOrderCancelled     EventType = "order.cancelled"
+
+	// EventOrderPersisted публикуется в исходящий топик после сохранения заказа
+	EventOrderPersisted EventType = "order.persisted"
+)
+
+const (
+	OrderStatusCreated   = "created"
+	OrderStatusCancelled = "cancelled"
+)
+
+// Event — версионированный конверт сообщения в топике orders.
+// Payload зависит от Type: Order, OrderStatusChanged, ItemStatusChanged,
+// Delivery или OrderCancelled.
+type Event struct {
+	EventID    string          `json:"event_id"`
+	Type       EventType       `json:"event_type"`
+	OrderUID   string          `json:"order_uid"`
+	Version    int64           `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type OrderStatusChanged struct {
+	Status string `json:"status"`
+}
+
+type ItemStatusChanged struct {
+	ChrtID int `json:"chrt_id"`
+	Status int `json:"status"`
+}
+
+type OrderCancelled struct {
+	Reason string `json:"reason"`
+}
+
+// OrderPersisted — payload события order.persisted: результат upsert'а
+// (created или updated) и сохраненный снимок заказа.
+type OrderPersisted struct {
+	Result string `json:"result"`
+	Order  Order  `json:"order"`
+}
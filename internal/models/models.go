@@ -17,6 +17,8 @@ type Order struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
+	Status            string    `json:"status,omitempty"`
+	Version           int64     `json:"version,omitempty"`
 }
 
 type Delivery struct {
@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
+	"github.com/yakovleviga/brokerService/internal/config"
+)
+
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(cfg config.Kafka, topic string) (*KafkaPublisher, error) {
+	writer, err := broker.NewKafkaWriter(cfg, topic)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaPublisher{writer: writer}, nil
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, msgs []Message) error {
+	out := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		headers := make([]kafka.Header, 0, len(m.Headers))
+		for k, v := range m.Headers {
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		out[i] = kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+	}
+
+	err := p.writer.WriteMessages(ctx, out...)
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		return BatchError(writeErrs)
+	}
+	return err
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
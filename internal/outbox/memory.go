@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MemoryPublisher хранит опубликованные сообщения в памяти — для тестов
+// relay'я без брокера. Ошибки, поставленные через FailNext, возвращаются
+// следующими вызовами Publish по очереди.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+	failures []error
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, msgs []Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.failures) > 0 {
+		err := p.failures[0]
+		p.failures = p.failures[1:]
+
+		// Для частичной неудачи сохраняем только прошедшие сообщения
+		if batchErr, ok := err.(BatchError); ok {
+			for i, m := range msgs {
+				if i < len(batchErr) && batchErr[i] == nil {
+					p.messages = append(p.messages, m)
+				}
+			}
+		}
+		return err
+	}
+
+	p.messages = append(p.messages, msgs...)
+	return nil
+}
+
+// FailNext ставит в очередь ошибку для следующего вызова Publish
+func (p *MemoryPublisher) FailNext(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = append(p.failures, err)
+}
+
+// Messages возвращает копию опубликованных сообщений в порядке отправки
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.messages)
+}
+
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
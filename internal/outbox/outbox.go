@@ -0,0 +1,210 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/metrics"
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+const HeaderEventType = "event-type"
+
+// Store — таблица outbox; реализуется db.Repository
+type Store interface {
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]db.OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, ids []int64) error
+	MarkOutboxFailed(ctx context.Context, id int64, cause string, retryAt time.Time) error
+}
+
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Publisher отправляет пачку сообщений. При частичной неудаче возвращает
+// BatchError с ошибкой для каждого сообщения (nil — отправлено); сообщения
+// без записи в BatchError считаются неотправленными.
+type Publisher interface {
+	Publish(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+type BatchError []error
+
+func (e BatchError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	if first == nil {
+		return "no errors"
+	}
+	return strconv.Itoa(failed) + " of " + strconv.Itoa(len(e)) + " messages failed: " + first.Error()
+}
+
+// Relay переносит события из outbox в брокер. Событие помечается
+// отправленным только после подтверждения брокера, поэтому при сбоях
+// возможны дубли (at-least-once); получатели отсеивают их по event_id.
+type Relay struct {
+	store Store
+	pub   Publisher
+	cfg   config.Outbox
+	log   *slog.Logger
+	now   func() time.Time
+}
+
+func NewRelay(store Store, pub Publisher, cfg config.Outbox, log *slog.Logger) *Relay {
+	return &Relay{
+		store: store,
+		pub:   pub,
+		cfg:   cfg,
+		log:   log.With("component", "outbox"),
+		now:   time.Now,
+	}
+}
+
+// Run публикует события до отмены ctx
+func (r *Relay) Run(ctx context.Context) error {
+	r.log.Info("outbox relay started", "topic", r.cfg.Topic)
+
+	for {
+		n, err := r.RunOnce(ctx)
+		if ctx.Err() != nil {
+			r.log.Info("outbox relay stopped")
+			return nil
+		}
+		if err != nil {
+			r.log.Error("outbox relay pass failed", "error", err)
+		}
+		// Следом могут ждать более поздние события тех же заказов: забираем сразу
+		if err == nil && n > 0 {
+			continue
+		}
+
+		t := time.NewTimer(r.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			r.log.Info("outbox relay stopped")
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// RunOnce забирает и публикует одну пачку, возвращает число забранных событий
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	pending, err := r.store.ClaimOutbox(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil {
+		return 0, errors.Wrap(err, "claim outbox")
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	msgs := make([]Message, len(pending))
+	for i, m := range pending {
+		if msgs[i], err = encode(m); err != nil {
+			return len(pending), errors.Wrapf(err, "encode outbox event %d", m.ID)
+		}
+	}
+
+	// Начатую отправку и отметки доводим до конца даже при остановке:
+	// иначе события уйдут повторно после истечения lease
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.Lease)
+	defer cancel()
+
+	pubErr := r.pub.Publish(ctx, msgs)
+
+	var batchErr BatchError
+	if pubErr != nil && !errors.As(pubErr, &batchErr) {
+		// Пачка не ушла целиком
+		batchErr = make(BatchError, len(pending))
+		for i := range batchErr {
+			batchErr[i] = pubErr
+		}
+	}
+
+	sent := make([]int64, 0, len(pending))
+	for i, m := range pending {
+		if batchErr != nil && (i >= len(batchErr) || batchErr[i] != nil) {
+			// Сообщение без записи в BatchError считаем неотправленным
+			cause := pubErr
+			if i < len(batchErr) {
+				cause = batchErr[i]
+			}
+			r.reschedule(ctx, m, cause)
+			continue
+		}
+		sent = append(sent, m.ID)
+	}
+
+	if len(sent) > 0 {
+		if err := r.store.MarkOutboxSent(ctx, sent); err != nil {
+			// События уже в брокере и уйдут повторно после lease
+			return len(pending), errors.Wrap(err, "mark outbox sent")
+		}
+		metrics.OutboxPublished.Add(float64(len(sent)))
+	}
+	if pubErr != nil {
+		return len(pending), errors.Wrap(pubErr, "publish outbox events")
+	}
+	return len(pending), nil
+}
+
+func (r *Relay) reschedule(ctx context.Context, m db.OutboxMessage, cause error) {
+	metrics.OutboxFailures.Inc()
+	retryAt := r.now().Add(r.backoff(m.Attempts))
+	if err := r.store.MarkOutboxFailed(ctx, m.ID, cause.Error(), retryAt); err != nil {
+		// Не страшно: событие вернется в работу после истечения lease
+		r.log.Error("failed to reschedule outbox event", "outbox_id", m.ID, "error", err)
+		return
+	}
+	r.log.Warn("outbox event rescheduled",
+		"outbox_id", m.ID, "order_uid", m.AggregateID, "attempts", m.Attempts, "retry_at", retryAt, "error", cause)
+}
+
+// backoff — экспоненциальная задержка по числу уже сделанных попыток
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.RetryInitialBackoff
+	for i := 1; i < attempts && d < r.cfg.RetryMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, r.cfg.RetryMaxBackoff)
+}
+
+// encode заворачивает событие в тот же конверт models.Event, что принимает
+// консьюмер; event_id — ID строки outbox, стабильный между повторами.
+func encode(m db.OutboxMessage) (Message, error) {
+	value, err := json.Marshal(models.Event{
+		EventID:    strconv.FormatInt(m.ID, 10),
+		Type:       models.EventType(m.EventType),
+		OrderUID:   m.AggregateID,
+		Version:    m.Version,
+		OccurredAt: m.CreatedAt,
+		Payload:    m.Payload,
+	})
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Key:     []byte(m.AggregateID),
+		Value:   value,
+		Headers: map[string]string{HeaderEventType: m.EventType},
+	}, nil
+}
@@ -0,0 +1,354 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+// fakeStore повторяет семантику таблицы outbox: Claim отдает доступные
+// неотправленные строки, перед которыми нет неотправленных строк того же
+// заказа, и увеличивает им attempts, MarkOutboxFailed откладывает строку до retryAt.
+type fakeStore struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	rows      []*fakeRow
+	sentCalls [][]int64
+	failed    []failedCall
+}
+
+type fakeRow struct {
+	msg         db.OutboxMessage
+	sent        bool
+	availableAt time.Time
+}
+
+type failedCall struct {
+	id      int64
+	cause   string
+	retryAt time.Time
+}
+
+func newFakeStore(now func() time.Time, n int) *fakeStore {
+	s := &fakeStore{now: now}
+	for i := 1; i <= n; i++ {
+		s.rows = append(s.rows, &fakeRow{msg: db.OutboxMessage{
+			ID:          int64(i),
+			AggregateID: "order-" + strconv.Itoa(i),
+			EventType:   string(models.EventOrderPersisted),
+			Version:     1,
+			Payload:     json.RawMessage(`{}`),
+		}})
+	}
+	return s
+}
+
+func (s *fakeStore) ClaimOutbox(_ context.Context, limit int, lease time.Duration) ([]db.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var claimed []db.OutboxMessage
+	blocked := make(map[string]bool)
+	for _, r := range s.rows {
+		if len(claimed) == limit {
+			break
+		}
+		if r.sent {
+			continue
+		}
+		if blocked[r.msg.AggregateID] {
+			continue
+		}
+		blocked[r.msg.AggregateID] = true
+		if r.availableAt.After(now) {
+			continue
+		}
+		r.msg.Attempts++
+		r.availableAt = now.Add(lease)
+		claimed = append(claimed, r.msg)
+	}
+	return claimed, nil
+}
+
+func (s *fakeStore) MarkOutboxSent(_ context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sentCalls = append(s.sentCalls, slices.Clone(ids))
+	for _, id := range ids {
+		s.row(id).sent = true
+	}
+	return nil
+}
+
+func (s *fakeStore) MarkOutboxFailed(_ context.Context, id int64, cause string, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = append(s.failed, failedCall{id: id, cause: cause, retryAt: retryAt})
+	s.row(id).availableAt = retryAt
+	return nil
+}
+
+func (s *fakeStore) row(id int64) *fakeRow {
+	for _, r := range s.rows {
+		if r.msg.ID == id {
+			return r
+		}
+	}
+	panic("unknown outbox id " + strconv.FormatInt(id, 10))
+}
+
+// sentIDs возвращает все ID, переданные в MarkOutboxSent, в порядке вызовов
+func (s *fakeStore) sentIDs() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Concat(s.sentCalls...)
+}
+
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func testConfig() config.Outbox {
+	return config.Outbox{
+		BatchSize:           10,
+		Lease:               30 * time.Second,
+		RetryInitialBackoff: time.Second,
+		RetryMaxBackoff:     time.Minute,
+	}
+}
+
+func newTestRelay(store Store, pub Publisher, clk *clock) *Relay {
+	r := NewRelay(store, pub, testConfig(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r.now = clk.now
+	return r
+}
+
+func publishedKeys(pub *MemoryPublisher) []string {
+	var keys []string
+	for _, m := range pub.Messages() {
+		keys = append(keys, string(m.Key))
+	}
+	return keys
+}
+
+func TestRelayPartialBatchFailure(t *testing.T) {
+	ctx := context.Background()
+	clk := &clock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newFakeStore(clk.now, 4)
+	pub := NewMemoryPublisher()
+	relay := newTestRelay(store, pub, clk)
+
+	brokerErr := errors.New("leader not available")
+	pub.FailNext(BatchError{nil, brokerErr, nil, brokerErr})
+
+	n, err := relay.RunOnce(ctx)
+	if n != 4 {
+		t.Fatalf("claimed %d events, want 4", n)
+	}
+	if err == nil {
+		t.Fatal("partial failure must be reported")
+	}
+
+	if got, want := store.sentIDs(), []int64{1, 3}; !slices.Equal(got, want) {
+		t.Fatalf("marked sent %v, want %v", got, want)
+	}
+	if got, want := publishedKeys(pub), []string{"order-1", "order-3"}; !slices.Equal(got, want) {
+		t.Fatalf("published %v, want %v", got, want)
+	}
+	if len(store.failed) != 2 {
+		t.Fatalf("rescheduled %d events, want 2", len(store.failed))
+	}
+	for i, id := range []int64{2, 4} {
+		f := store.failed[i]
+		if f.id != id {
+			t.Errorf("rescheduled event %d, want %d", f.id, id)
+		}
+		if want := clk.now().Add(time.Second); !f.retryAt.Equal(want) {
+			t.Errorf("event %d retry at %v, want %v after the first attempt", f.id, f.retryAt, want)
+		}
+		if f.cause != brokerErr.Error() {
+			t.Errorf("event %d cause %q, want %q", f.id, f.cause, brokerErr.Error())
+		}
+	}
+
+	// До retryAt отложенные события не забираются
+	if n, err := relay.RunOnce(ctx); n != 0 || err != nil {
+		t.Fatalf("before backoff: claimed %d, err %v; want nothing", n, err)
+	}
+
+	clk.advance(time.Second)
+	pub.FailNext(BatchError{nil, brokerErr})
+	if n, err := relay.RunOnce(ctx); n != 2 || err == nil {
+		t.Fatalf("second pass: claimed %d, err %v; want 2 and partial failure", n, err)
+	}
+	// Вторая неудача — задержка удваивается
+	last := store.failed[len(store.failed)-1]
+	if last.id != 4 || !last.retryAt.Equal(clk.now().Add(2*time.Second)) {
+		t.Fatalf("second failure: %+v, want event 4 retried after 2s", last)
+	}
+
+	clk.advance(2 * time.Second)
+	if n, err := relay.RunOnce(ctx); n != 1 || err != nil {
+		t.Fatalf("third pass: claimed %d, err %v; want 1 event published", n, err)
+	}
+
+	// Каждое событие отмечено отправленным ровно один раз
+	sent := store.sentIDs()
+	slices.Sort(sent)
+	if want := []int64{1, 2, 3, 4}; !slices.Equal(sent, want) {
+		t.Fatalf("marked sent %v, want each of %v exactly once", sent, want)
+	}
+	if got, want := publishedKeys(pub), []string{"order-1", "order-3", "order-2", "order-4"}; !slices.Equal(got, want) {
+		t.Fatalf("published %v, want %v", got, want)
+	}
+	if n, err := relay.RunOnce(ctx); n != 0 || err != nil {
+		t.Fatalf("drained outbox: claimed %d, err %v; want nothing", n, err)
+	}
+}
+
+func TestRelayWholeBatchFailure(t *testing.T) {
+	ctx := context.Background()
+	clk := &clock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newFakeStore(clk.now, 3)
+	pub := NewMemoryPublisher()
+	relay := newTestRelay(store, pub, clk)
+
+	pub.FailNext(errors.New("connection refused"))
+	if _, err := relay.RunOnce(ctx); err == nil {
+		t.Fatal("publish failure must be reported")
+	}
+
+	if sent := store.sentIDs(); len(sent) != 0 {
+		t.Fatalf("marked sent %v, want nothing", sent)
+	}
+	if len(pub.Messages()) != 0 {
+		t.Fatalf("published %d messages, want none", len(pub.Messages()))
+	}
+	var ids []int64
+	for _, f := range store.failed {
+		ids = append(ids, f.id)
+	}
+	if want := []int64{1, 2, 3}; !slices.Equal(ids, want) {
+		t.Fatalf("rescheduled %v, want %v", ids, want)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := &Relay{cfg: config.Outbox{RetryInitialBackoff: time.Second, RetryMaxBackoff: 10 * time.Second}}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Second},
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 3, want: 4 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 5, want: 10 * time.Second},
+		{attempts: 50, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRelayShortBatchError(t *testing.T) {
+	ctx := context.Background()
+	clk := &clock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newFakeStore(clk.now, 3)
+	pub := NewMemoryPublisher()
+	relay := newTestRelay(store, pub, clk)
+
+	// Publisher вернул ошибки не для всех сообщений пачки
+	pub.FailNext(BatchError{nil})
+	if _, err := relay.RunOnce(ctx); err == nil {
+		t.Fatal("short batch error must be reported")
+	}
+
+	if got, want := store.sentIDs(), []int64{1}; !slices.Equal(got, want) {
+		t.Fatalf("marked sent %v, want %v", got, want)
+	}
+	var ids []int64
+	for _, f := range store.failed {
+		ids = append(ids, f.id)
+	}
+	if want := []int64{2, 3}; !slices.Equal(ids, want) {
+		t.Fatalf("rescheduled %v, want events without a result %v", ids, want)
+	}
+}
+
+func TestRelayKeepsOrderPerKey(t *testing.T) {
+	ctx := context.Background()
+	clk := &clock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := newFakeStore(clk.now, 4)
+	// Два события order-a, между ними события других заказов
+	for i, key := range []string{"order-a", "order-b", "order-a", "order-c"} {
+		store.rows[i].msg.AggregateID = key
+	}
+	pub := NewMemoryPublisher()
+	relay := newTestRelay(store, pub, clk)
+
+	brokerErr := errors.New("leader not available")
+	pub.FailNext(BatchError{brokerErr, nil, nil})
+	if n, _ := relay.RunOnce(ctx); n != 3 {
+		t.Fatalf("claimed %d events, want 3: the second order-a event waits for the first", n)
+	}
+
+	// Первое событие order-a отложено — второе не уходит раньше него
+	clk.advance(500 * time.Millisecond)
+	if n, err := relay.RunOnce(ctx); n != 0 || err != nil {
+		t.Fatalf("while order-a is rescheduled: claimed %d, err %v; want nothing", n, err)
+	}
+
+	clk.advance(500 * time.Millisecond)
+	if n, err := relay.RunOnce(ctx); n != 1 || err != nil {
+		t.Fatalf("after backoff: claimed %d, err %v; want the first order-a event", n, err)
+	}
+	if n, err := relay.RunOnce(ctx); n != 1 || err != nil {
+		t.Fatalf("next pass: claimed %d, err %v; want the second order-a event", n, err)
+	}
+
+	var ids []string
+	for _, m := range pub.Messages() {
+		var e models.Event
+		if err := json.Unmarshal(m.Value, &e); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.EventID)
+	}
+	if want := []string{"2", "4", "1", "3"}; !slices.Equal(ids, want) {
+		t.Fatalf("published events %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/auth"
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/logger"
+	"github.com/yakovleviga/brokerService/internal/metrics"
+)
+
+// Группы маршрутов с отдельными лимитами
+const (
+	GroupOrders = "orders" // чтение заказа по ключу
+	GroupSearch = "search" // списки и поиск по вторичным ключам
+	GroupAdmin  = "admin"
+	// GroupAuth ограничивает все запросы к API по IP до аутентификации,
+	// чтобы перебор ключей и токенов тоже упирался в лимит
+	GroupAuth = "auth"
+)
+
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset"
+)
+
+type Limiter struct {
+	enabled bool
+	store   Store
+	limits  map[string]Limit
+	log     *slog.Logger
+}
+
+func NewLimiter(cfg config.RateLimit, store Store, log *slog.Logger) (*Limiter, error) {
+	limits, err := ParseLimits(cfg.Groups)
+	if err != nil {
+		return nil, err
+	}
+	return &Limiter{
+		enabled: cfg.Enabled,
+		store:   store,
+		limits:  limits,
+		log:     log.With("component", "ratelimit"),
+	}, nil
+}
+
+// ParseLimits разбирает лимиты групп вида "20/40" (запросов в секунду/burst)
+func ParseLimits(groups map[string]string) (map[string]Limit, error) {
+	limits := make(map[string]Limit, len(groups))
+	for group, spec := range groups {
+		rate, burst, ok := strings.Cut(spec, "/")
+		if !ok {
+			return nil, errors.Errorf("rate limit %q for group %s must be rate/burst", spec, group)
+		}
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r <= 0 {
+			return nil, errors.Errorf("rate limit for group %s: invalid rate %q", group, rate)
+		}
+		b, err := strconv.Atoi(burst)
+		if err != nil || b < 1 {
+			return nil, errors.Errorf("rate limit for group %s: invalid burst %q", group, burst)
+		}
+		limits[group] = Limit{Rate: r, Burst: b}
+	}
+	return limits, nil
+}
+
+// Group возвращает middleware с лимитом группы. Клиент определяется по
+// API-ключу или subject токена, анонимный или токен без subject — по IP.
+// Должен стоять после auth.Authenticator.Middleware.
+func (l *Limiter) Group(group string) fiber.Handler {
+	return l.handler(group, func(c *fiber.Ctx) string {
+		if p, ok := auth.FromContext(c.UserContext()); ok && p.Method != auth.MethodNone && p.Subject != "" {
+			return group + ":" + p.Method + ":" + p.Subject
+		}
+		return group + ":ip:" + c.IP()
+	})
+}
+
+// IP возвращает middleware с лимитом группы по IP клиента. Ставится перед
+// аутентификацией, поэтому ограничивает и ответы 401/403.
+func (l *Limiter) IP(group string) fiber.Handler {
+	return l.handler(group, func(c *fiber.Ctx) string {
+		return group + ":ip:" + c.IP()
+	})
+}
+
+func (l *Limiter) handler(group string, key func(c *fiber.Ctx) string) fiber.Handler {
+	limit, ok := l.limits[group]
+	if !l.enabled || !ok {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+
+	return func(c *fiber.Ctx) error {
+		res, err := l.store.Take(c.UserContext(), key(c), limit)
+		if err != nil {
+			// Недоступность хранилища лимитов не должна ронять API
+			logger.FromContext(c.UserContext(), l.log).Warn("rate limit store failed", "error", err)
+			return c.Next()
+		}
+
+		c.Set(HeaderLimit, strconv.Itoa(res.Limit))
+		c.Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+		c.Set(HeaderReset, strconv.Itoa(ceilSeconds(res.Reset.Seconds())))
+		if !res.Allowed {
+			metrics.HTTPRateLimited.WithLabelValues(group).Inc()
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(ceilSeconds(res.RetryAfter.Seconds()), 1)))
+			return fiber.NewError(fiber.StatusTooManyRequests, "rate limit exceeded")
+		}
+		return c.Next()
+	}
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
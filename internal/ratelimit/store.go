@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit — параметры token bucket: Rate токенов в секунду, не больше Burst
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter — через сколько появится следующий токен (0, если запрос пропущен)
+	RetryAfter time.Duration
+	// Reset — через сколько корзина наполнится полностью
+	Reset time.Duration
+}
+
+// Store хранит состояние корзин. Реализация в памяти подходит для одного
+// инстанса; для нескольких нужен общий store (например, в Redis).
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	idleTTL   time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore(idleTTL time.Duration) *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		idleTTL: idleTTL,
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	// Пополняем корзину за прошедшее время
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return res, nil
+}
+
+// sweep удаляет корзины клиентов, которые давно не приходили. Вызывается
+// не чаще раза в idleTTL, чтобы не обходить map на каждом запросе.
+func (s *MemoryStore) sweep(now time.Time) {
+	if s.idleTTL <= 0 || now.Sub(s.lastSweep) < s.idleTTL {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= s.idleTTL {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type takeStep struct {
+	// Сколько прошло с предыдущего запроса
+	after time.Duration
+
+	wantAllowed    bool
+	wantRemaining  int
+	wantRetryAfter time.Duration
+	wantReset      time.Duration
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		steps []takeStep
+	}{
+		{
+			name:  "burst then reject",
+			limit: Limit{Rate: 1, Burst: 3},
+			steps: []takeStep{
+				{wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{wantAllowed: true, wantRemaining: 1, wantReset: 2 * time.Second},
+				{wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+				{wantAllowed: false, wantRemaining: 0, wantRetryAfter: time.Second, wantReset: 3 * time.Second},
+			},
+		},
+		{
+			name:  "partial refill shortens retry after",
+			limit: Limit{Rate: 2, Burst: 1},
+			steps: []takeStep{
+				{wantAllowed: true, wantRemaining: 0, wantReset: 500 * time.Millisecond},
+				{after: 200 * time.Millisecond, wantAllowed: false, wantRetryAfter: 300 * time.Millisecond, wantReset: 300 * time.Millisecond},
+				{after: 300 * time.Millisecond, wantAllowed: true, wantRemaining: 0, wantReset: 500 * time.Millisecond},
+			},
+		},
+		{
+			name:  "refill is capped by burst",
+			limit: Limit{Rate: 10, Burst: 2},
+			steps: []takeStep{
+				{wantAllowed: true, wantRemaining: 1, wantReset: 100 * time.Millisecond},
+				{wantAllowed: true, wantRemaining: 0, wantReset: 200 * time.Millisecond},
+				{after: time.Hour, wantAllowed: true, wantRemaining: 1, wantReset: 100 * time.Millisecond},
+				{wantAllowed: true, wantRemaining: 0, wantReset: 200 * time.Millisecond},
+				{wantAllowed: false, wantRemaining: 0, wantRetryAfter: 100 * time.Millisecond, wantReset: 200 * time.Millisecond},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			s := NewMemoryStore(0)
+			s.now = func() time.Time { return now }
+
+			for i, step := range tt.steps {
+				now = now.Add(step.after)
+				res, err := s.Take(context.Background(), "client", tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Allowed != step.wantAllowed || res.Remaining != step.wantRemaining {
+					t.Fatalf("step %d: allowed %v, remaining %d; want %v, %d",
+						i, res.Allowed, res.Remaining, step.wantAllowed, step.wantRemaining)
+				}
+				if !near(res.RetryAfter, step.wantRetryAfter) {
+					t.Errorf("step %d: retry after %v, want %v", i, res.RetryAfter, step.wantRetryAfter)
+				}
+				if !near(res.Reset, step.wantReset) {
+					t.Errorf("step %d: reset %v, want %v", i, res.Reset, step.wantReset)
+				}
+				if res.Limit != tt.limit.Burst {
+					t.Errorf("step %d: limit %d, want %d", i, res.Limit, tt.limit.Burst)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeysAreIndependent(t *testing.T) {
+	s := NewMemoryStore(0)
+	limit := Limit{Rate: 1, Burst: 1}
+	ctx := context.Background()
+
+	if res, _ := s.Take(ctx, "a", limit); !res.Allowed {
+		t.Fatal("first request of a rejected")
+	}
+	if res, _ := s.Take(ctx, "a", limit); res.Allowed {
+		t.Fatal("second request of a allowed beyond burst")
+	}
+	if res, _ := s.Take(ctx, "b", limit); !res.Allowed {
+		t.Fatal("b limited by requests of a")
+	}
+}
+
+func TestMemoryStoreSweepsIdleBuckets(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(time.Minute)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.Take(ctx, "idle", Limit{Rate: 1, Burst: 1})
+	now = now.Add(2 * time.Minute)
+	s.Take(ctx, "active", Limit{Rate: 1, Burst: 1})
+
+	if _, ok := s.buckets["idle"]; ok {
+		t.Fatal("idle bucket not swept")
+	}
+	if _, ok := s.buckets["active"]; !ok {
+		t.Fatal("active bucket swept")
+	}
+}
+
+// near сравнивает длительности с точностью до погрешности float64
+func near(got, want time.Duration) bool {
+	d := got - want
+	return d > -time.Microsecond && d < time.Microsecond
+}
@@ -0,0 +1,156 @@
+package redact
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+// Короткие ключи, под которыми PII чаще всего попадают в логи
+var logAliases = map[string]string{
+	"phone":   FieldPhone,
+	"email":   FieldEmail,
+	"address": FieldAddress,
+}
+
+// Ключи, значения под которыми скрываются целиком: аргументы SQL-запросов
+// в data трейсера pgx могут содержать любые PII
+var opaqueKeys = map[string]bool{
+	"args": true,
+}
+
+// Handler маскирует PII в записях лога независимо от скоупов: атрибуты с
+// ключами вида delivery.phone (или группой delivery и ключом phone), такие же
+// ключи внутри map[string]any, а также целые заказы и адреса доставки,
+// переданные значением.
+type Handler struct {
+	next   slog.Handler
+	r      *Redactor
+	groups []string
+}
+
+func NewHandler(next slog.Handler, r *Redactor) *Handler {
+	return &Handler{next: next, r: r}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, rec slog.Record) error {
+	masked := slog.NewRecord(rec.Time, rec.Level, rec.Message, rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		masked.AddAttrs(h.attr(h.groups, a))
+		return true
+	})
+	return h.next.Handle(ctx, masked)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = h.attr(h.groups, a)
+	}
+	return &Handler{next: h.next.WithAttrs(masked), r: h.r, groups: h.groups}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{next: h.next.WithGroup(name), r: h.r, groups: append(h.groups[:len(h.groups):len(h.groups)], name)}
+}
+
+func (h *Handler) attr(groups []string, a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	switch v.Kind() {
+	case slog.KindGroup:
+		nested := append(groups[:len(groups):len(groups)], a.Key)
+		attrs := v.Group()
+		masked := make([]slog.Attr, len(attrs))
+		for i, ga := range attrs {
+			masked[i] = h.attr(nested, ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(masked...)}
+	case slog.KindString:
+		if field, ok := h.field(groups, a.Key); ok {
+			return slog.String(a.Key, h.r.Mask(field, v.String()))
+		}
+	case slog.KindAny:
+		if m, ok := v.Any().(map[string]any); ok {
+			return slog.Any(a.Key, h.mapValue(append(groups[:len(groups):len(groups)], a.Key), m))
+		}
+		if masked, ok := h.value(v.Any()); ok {
+			return slog.Any(a.Key, masked)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// mapValue возвращает копию m с замаскированными значениями; ключи
+// проверяются так же, как у атрибутов, а вложенные map обходятся рекурсивно
+func (h *Handler) mapValue(groups []string, m map[string]any) map[string]any {
+	masked := make(map[string]any, len(m))
+	for key, v := range m {
+		switch val := v.(type) {
+		case string:
+			if field, ok := h.field(groups, key); ok {
+				v = h.r.Mask(field, val)
+			}
+		case map[string]any:
+			v = h.mapValue(append(groups[:len(groups):len(groups)], key), val)
+		default:
+			if mv, ok := h.value(v); ok {
+				v = mv
+			}
+		}
+		if opaqueKeys[strings.ToLower(key)] {
+			v = mask
+		}
+		masked[key] = v
+	}
+	return masked
+}
+
+func (h *Handler) field(groups []string, key string) (string, bool) {
+	path := strings.ToLower(strings.Join(append(groups[:len(groups):len(groups)], key), "."))
+	if _, ok := h.r.rules[path]; ok {
+		return path, true
+	}
+	field, ok := logAliases[strings.ToLower(key)]
+	return field, ok
+}
+
+func (h *Handler) value(v any) (any, bool) {
+	switch v := v.(type) {
+	case models.Delivery:
+		return h.r.MaskDelivery(v), true
+	case db.Delivery:
+		return db.Delivery(h.r.MaskDelivery(models.Delivery(v))), true
+	case models.Order:
+		v.Delivery = h.r.MaskDelivery(v.Delivery)
+		return v, true
+	case *models.Order:
+		if v == nil {
+			return v, false
+		}
+		o := *v
+		o.Delivery = h.r.MaskDelivery(o.Delivery)
+		return o, true
+	case db.FullOrder:
+		v.Delivery = db.Delivery(h.r.MaskDelivery(models.Delivery(v.Delivery)))
+		return v, true
+	case *db.FullOrder:
+		if v == nil {
+			return v, false
+		}
+		o := *v
+		o.Delivery = db.Delivery(h.r.MaskDelivery(models.Delivery(o.Delivery)))
+		return o, true
+	}
+	return v, false
+}
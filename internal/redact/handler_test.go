@@ -0,0 +1,100 @@
+package redact
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+func newTestLogger(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+
+	r, err := NewRedactor(config.Redaction{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	next := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return slog.New(NewHandler(next, r)), &buf
+}
+
+func TestHandlerMasksPgxData(t *testing.T) {
+	log, buf := newTestLogger(t)
+
+	const phone = "+79991234567"
+	// Так tracelog pgx передает данные запроса
+	log.Debug("Query", "pgx", map[string]any{
+		"sql":        "INSERT INTO delivery (order_uid, name, phone) VALUES ($1, $2, $3)",
+		"args":       []any{"b563feb7b2b84b6test", "Test Testov", phone},
+		"commandTag": "INSERT 0 1",
+		"delivery": map[string]any{
+			"phone": phone,
+			"email": "test@gmail.com",
+		},
+	})
+
+	out := buf.String()
+	for _, leaked := range []string{phone, "Test Testov", "test@gmail.com"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("log contains %q: %s", leaked, out)
+		}
+	}
+	for _, kept := range []string{"INSERT INTO delivery", "INSERT 0 1", `"phone":"********4567"`, `"email":"t***@gmail.com"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("log lacks %q: %s", kept, out)
+		}
+	}
+}
+
+func TestHandlerMasksAttributes(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   func(l *slog.Logger)
+		leak  string
+		wants string
+	}{
+		{
+			name:  "dotted key",
+			log:   func(l *slog.Logger) { l.Info("msg", "delivery.phone", "+79991234567") },
+			leak:  "+79991234567",
+			wants: `"delivery.phone":"********4567"`,
+		},
+		{
+			name:  "group",
+			log:   func(l *slog.Logger) { l.Info("msg", slog.Group("delivery", "name", "Test Testov")) },
+			leak:  "Test Testov",
+			wants: `"name":"T. T."`,
+		},
+		{
+			name:  "alias",
+			log:   func(l *slog.Logger) { l.With("email", "test@gmail.com").Info("msg") },
+			leak:  "test@gmail.com",
+			wants: `"email":"t***@gmail.com"`,
+		},
+		{
+			name:  "delivery value",
+			log:   func(l *slog.Logger) { l.Info("msg", "delivery", models.Delivery{City: "Kiryat Mozkin"}) },
+			leak:  "Kiryat Mozkin",
+			wants: `"city":"***"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, buf := newTestLogger(t)
+			tt.log(log)
+
+			out := buf.String()
+			if strings.Contains(out, tt.leak) {
+				t.Errorf("log contains %q: %s", tt.leak, out)
+			}
+			if !strings.Contains(out, tt.wants) {
+				t.Errorf("log lacks %s: %s", tt.wants, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package redact
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+type Strategy string
+
+const (
+	StrategyNone     Strategy = "none"     // значение не маскируется
+	StrategyFull     Strategy = "full"     // значение целиком заменяется на ***
+	StrategyPartial  Strategy = "partial"  // видны только последние 4 символа
+	StrategyEmail    Strategy = "email"    // первая буква и домен: t***@gmail.com
+	StrategyInitials Strategy = "initials" // первые буквы слов: T. T.
+)
+
+// Поля заказа, для которых можно задать правило маскирования
+const (
+	FieldName    = "delivery.name"
+	FieldPhone   = "delivery.phone"
+	FieldZip     = "delivery.zip"
+	FieldCity    = "delivery.city"
+	FieldAddress = "delivery.address"
+	FieldRegion  = "delivery.region"
+	FieldEmail   = "delivery.email"
+)
+
+var fields = []string{FieldName, FieldPhone, FieldZip, FieldCity, FieldAddress, FieldRegion, FieldEmail}
+
+// defaultRules дополняются правилами из конфигурации; поле без правила
+// маскируется целиком
+var defaultRules = map[string]Strategy{
+	FieldName:    StrategyInitials,
+	FieldPhone:   StrategyPartial,
+	FieldAddress: StrategyFull,
+	FieldEmail:   StrategyEmail,
+}
+
+const mask = "***"
+
+type ctxKey struct{}
+
+type Redactor struct {
+	rules     map[string]Strategy
+	piiScopes []string
+}
+
+func NewRedactor(cfg config.Redaction) (*Redactor, error) {
+	r := &Redactor{
+		rules:     maps.Clone(defaultRules),
+		piiScopes: cfg.PIIScopes,
+	}
+	for field, strategy := range cfg.Rules {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !slices.Contains(fields, field) {
+			return nil, errors.Errorf("unknown redaction field %q", field)
+		}
+		s := Strategy(strings.ToLower(strings.TrimSpace(strategy)))
+		switch s {
+		case StrategyNone, StrategyFull, StrategyPartial, StrategyEmail, StrategyInitials:
+		default:
+			return nil, errors.Errorf("unknown redaction strategy %q for %s", strategy, field)
+		}
+		r.rules[field] = s
+	}
+	for _, field := range fields {
+		if _, ok := r.rules[field]; !ok {
+			r.rules[field] = StrategyFull
+		}
+	}
+	return r, nil
+}
+
+// WithScopes запоминает скоупы вызывающей стороны, по которым решается,
+// показывать ли PII в ответе.
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, scopes)
+}
+
+// CanViewPII сообщает, есть ли у вызывающей стороны скоуп на просмотр PII
+func (r *Redactor) CanViewPII(ctx context.Context) bool {
+	scopes, _ := ctx.Value(ctxKey{}).([]string)
+	for _, s := range scopes {
+		if slices.Contains(r.piiScopes, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask маскирует значение по правилу поля; значения не из delivery не меняются
+func (r *Redactor) Mask(field, value string) string {
+	strategy, ok := r.rules[field]
+	if !ok || value == "" {
+		return value
+	}
+	return apply(strategy, value)
+}
+
+func (r *Redactor) MaskDelivery(d models.Delivery) models.Delivery {
+	return models.Delivery{
+		Name:    r.Mask(FieldName, d.Name),
+		Phone:   r.Mask(FieldPhone, d.Phone),
+		Zip:     r.Mask(FieldZip, d.Zip),
+		City:    r.Mask(FieldCity, d.City),
+		Address: r.Mask(FieldAddress, d.Address),
+		Region:  r.Mask(FieldRegion, d.Region),
+		Email:   r.Mask(FieldEmail, d.Email),
+	}
+}
+
+// Order возвращает копию заказа, в которой PII замаскированы, если
+// у вызывающей стороны нет скоупа на их просмотр.
+func (r *Redactor) Order(ctx context.Context, o db.FullOrder) db.FullOrder {
+	if r.CanViewPII(ctx) {
+		return o
+	}
+	o.Delivery = db.Delivery(r.MaskDelivery(models.Delivery(o.Delivery)))
+	return o
+}
+
+func (r *Redactor) Orders(ctx context.Context, orders []db.FullOrder) []db.FullOrder {
+	if r.CanViewPII(ctx) {
+		return orders
+	}
+	masked := make([]db.FullOrder, len(orders))
+	for i, o := range orders {
+		masked[i] = r.Order(ctx, o)
+	}
+	return masked
+}
+
+func apply(strategy Strategy, value string) string {
+	switch strategy {
+	case StrategyNone:
+		return value
+	case StrategyPartial:
+		n := utf8.RuneCountInString(value)
+		if n <= 4 {
+			return mask
+		}
+		runes := []rune(value)
+		return strings.Repeat("*", n-4) + string(runes[n-4:])
+	case StrategyEmail:
+		at := strings.LastIndexByte(value, '@')
+		if at <= 0 {
+			return mask
+		}
+		first, _ := utf8.DecodeRuneInString(value)
+		return string(first) + mask + value[at:]
+	case StrategyInitials:
+		words := strings.Fields(value)
+		for i, w := range words {
+			first, _ := utf8.DecodeRuneInString(w)
+			words[i] = string(first) + "."
+		}
+		return strings.Join(words, " ")
+	default:
+		return mask
+	}
+}
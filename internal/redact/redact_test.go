@@ -0,0 +1,123 @@
+package redact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		value    string
+		want     string
+	}{
+		{StrategyNone, "+79991234567", "+79991234567"},
+		{StrategyFull, "Ploshad Mira 15", "***"},
+		{StrategyPartial, "+79991234567", "********4567"},
+		{StrategyPartial, "1234", "***"},
+		{StrategyPartial, "Москва-12345", "********2345"},
+		{StrategyEmail, "test@gmail.com", "t***@gmail.com"},
+		{StrategyEmail, "тест@почта.рф", "т***@почта.рф"},
+		{StrategyEmail, "not-an-email", "***"},
+		{StrategyEmail, "@gmail.com", "***"},
+		{StrategyInitials, "Test Testov", "T. T."},
+		{StrategyInitials, "  Иван   Петров ", "И. П."},
+		{Strategy("unknown"), "value", "***"},
+	}
+
+	for _, tt := range tests {
+		if got := apply(tt.strategy, tt.value); got != tt.want {
+			t.Errorf("apply(%s, %q) = %q, want %q", tt.strategy, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRedactorRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]string
+		field string
+		value string
+		want  string
+	}{
+		{name: "default name", field: FieldName, value: "Test Testov", want: "T. T."},
+		{name: "default phone", field: FieldPhone, value: "+9720000000", want: "*******0000"},
+		{name: "default email", field: FieldEmail, value: "test@gmail.com", want: "t***@gmail.com"},
+		{name: "field without default", field: FieldCity, value: "Kiryat Mozkin", want: "***"},
+		{name: "empty value", field: FieldName, value: "", want: ""},
+		{name: "not a delivery field", field: "payment.bank", value: "alpha", want: "alpha"},
+		{
+			name:  "override",
+			rules: map[string]string{FieldPhone: "full"},
+			field: FieldPhone, value: "+9720000000", want: "***",
+		},
+		{
+			name:  "override is case-insensitive",
+			rules: map[string]string{" Delivery.City ": " NONE "},
+			field: FieldCity, value: "Kiryat Mozkin", want: "Kiryat Mozkin",
+		},
+		{
+			name:  "override keeps other defaults",
+			rules: map[string]string{FieldCity: "none"},
+			field: FieldName, value: "Test Testov", want: "T. T.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor(config.Redaction{Rules: tt.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Mask(tt.field, tt.value); got != tt.want {
+				t.Errorf("Mask(%s, %q) = %q, want %q", tt.field, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRedactorRejectsUnknownRules(t *testing.T) {
+	for _, rules := range []map[string]string{
+		{"delivery.passport": "full"},
+		{FieldPhone: "hash"},
+	} {
+		if _, err := NewRedactor(config.Redaction{Rules: rules}); err == nil {
+			t.Errorf("NewRedactor(%v) succeeded, want error", rules)
+		}
+	}
+}
+
+func TestRedactorOrderScopes(t *testing.T) {
+	r, err := NewRedactor(config.Redaction{PIIScopes: []string{"orders:read:pii", "admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := db.FullOrder{OrderUID: "o1", Delivery: db.Delivery{Name: "Test Testov", Phone: "+9720000000"}}
+
+	tests := []struct {
+		name   string
+		scopes []string
+		want   db.Delivery
+	}{
+		{name: "no scopes", want: db.Delivery{Name: "T. T.", Phone: "*******0000"}},
+		{name: "read only", scopes: []string{"orders:read"}, want: db.Delivery{Name: "T. T.", Phone: "*******0000"}},
+		{name: "pii scope", scopes: []string{"orders:read", "orders:read:pii"}, want: order.Delivery},
+		{name: "admin", scopes: []string{"admin"}, want: order.Delivery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithScopes(context.Background(), tt.scopes)
+			got := r.Order(ctx, order)
+			if got.Delivery != tt.want {
+				t.Errorf("delivery %+v, want %+v", got.Delivery, tt.want)
+			}
+			if got.OrderUID != order.OrderUID {
+				t.Errorf("order_uid %q, want %q", got.OrderUID, order.OrderUID)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type OrderListResponse struct {
+	// []models.Order или, в режиме совместимости, []legacyOrder
+	Orders     any    `json:"orders"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListOrders — GET /v1/orders?customer_id=&delivery_service=&created_from=&created_to=
+// &provider=&bank=&currency=&locale=&brand=&sort=-date_created&limit=50&cursor=
+func (s *OrderService) ListOrders(c *fiber.Ctx) error {
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	page, err := s.db.ListOrders(c.UserContext(), filter)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid cursor")
+	}
+	if err != nil {
+		return errors.Wrap(err, "list orders")
+	}
+
+	return c.JSON(OrderListResponse{
+		Orders:     s.toResponse(c, page.Orders),
+		NextCursor: page.NextCursor,
+	})
+}
+
+func parseOrderFilter(c *fiber.Ctx) (db.OrderFilter, error) {
+	filter := db.OrderFilter{
+		CustomerID:      c.Query("customer_id"),
+		DeliveryService: c.Query("delivery_service"),
+		Provider:        c.Query("provider"),
+		Bank:            c.Query("bank"),
+		Currency:        c.Query("currency"),
+		Locale:          c.Query("locale"),
+		Brand:           c.Query("brand"),
+		Cursor:          c.Query("cursor"),
+		Limit:           c.QueryInt("limit", defaultPageSize),
+	}
+
+	if filter.Limit <= 0 || filter.Limit > maxPageSize {
+		return filter, errors.New("limit must be between 1 and 500")
+	}
+
+	for param, dst := range map[string]*time.Time{
+		"created_from": &filter.CreatedFrom,
+		"created_to":   &filter.CreatedTo,
+	} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, errors.New(param + " must be an RFC 3339 timestamp")
+			}
+			*dst = t
+		}
+	}
+
+	sort := c.Query("sort", "-date_created")
+	filter.SortDesc = strings.HasPrefix(sort, "-")
+	filter.SortBy = db.SortField(strings.TrimPrefix(sort, "-"))
+	switch filter.SortBy {
+	case db.SortByDateCreated, db.SortByOrderUID, db.SortByAmount:
+	default:
+		return filter, errors.New("sort must be one of date_created, order_uid, amount with optional - prefix")
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yakovleviga/brokerService/internal/cache"
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+const loadTimeout = 5 * time.Second
+
+// loadOrder загружает заказ, которого нет в кэше. Параллельные промахи по
+// одному ключу делят одну загрузку из БД, а «не найден» запоминается в
+// негативном кэше, чтобы поток несуществующих ID не доходил до Postgres.
+func (s *OrderService) loadOrder(ctx context.Context, kind cache.LookupKind, key string, load func(ctx context.Context) (*db.FullOrder, error)) (db.FullOrder, error) {
+	if s.cache.IsNotFound(kind, key) {
+		return db.FullOrder{}, db.ErrOrderNotFound
+	}
+
+	ch := s.loads.DoChan(string(kind)+":"+key, func() (any, error) {
+		// Загрузка общая, поэтому не зависит от отмены запроса, который ее начал
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		lookup := s.cache.BeginLookup(kind, key)
+		defer lookup.End()
+
+		order, err := load(ctx)
+		if errors.Is(err, db.ErrOrderNotFound) {
+			lookup.NotFound()
+			return nil, err
+		}
+		if errors.Is(err, db.ErrOrderIncomplete) {
+			// Заказ без delivery/payment — нарушение целостности, а не обычный промах
+			s.logger(ctx).Warn("incomplete order in database", "lookup", kind, "key", key, "error", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.cache.Set(*order)
+		return *order, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return db.FullOrder{}, res.Err
+		}
+		return res.Val.(db.FullOrder), nil
+	case <-ctx.Done():
+		return db.FullOrder{}, ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+
+	"github.com/yakovleviga/brokerService/internal/cache"
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+const lookupLimit = 100
+
+func (s *OrderService) GetOrderByTrackNumber(c *fiber.Ctx) error {
+	trackNumber := c.Params("track_number")
+	if trackNumber == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "missing track_number")
+	}
+
+	order, found := s.cache.GetByTrackNumber(trackNumber)
+	if !found {
+		var err error
+		order, err = s.loadOrder(c.UserContext(), cache.ByTrackNumber, trackNumber, func(ctx context.Context) (*db.FullOrder, error) {
+			return s.db.GetOrderByTrackNumber(ctx, trackNumber)
+		})
+		if err != nil {
+			return errors.Wrap(err, "load order by track number")
+		}
+	}
+
+	return s.renderOrder(c, order)
+}
+
+func (s *OrderService) GetOrderByRid(c *fiber.Ctx) error {
+	rid := c.Params("rid")
+	if rid == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "missing rid")
+	}
+
+	order, found := s.cache.GetByRid(rid)
+	if !found {
+		var err error
+		order, err = s.loadOrder(c.UserContext(), cache.ByRid, rid, func(ctx context.Context) (*db.FullOrder, error) {
+			return s.db.GetOrderByRid(ctx, rid)
+		})
+		if err != nil {
+			return errors.Wrap(err, "load order by rid")
+		}
+	}
+
+	return s.renderOrder(c, order)
+}
+
+func (s *OrderService) GetOrdersByCustomerID(c *fiber.Ctx) error {
+	customerID := c.Params("customer_id")
+	if customerID == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "missing customer_id")
+	}
+
+	if orders, ok := s.cache.GetByCustomerID(customerID); ok {
+		return s.renderOrders(c, orders[:min(len(orders), lookupLimit)])
+	}
+
+	lookup := s.cache.BeginLookup(cache.ByCustomerID, customerID)
+	defer lookup.End()
+
+	uids, err := s.db.GetOrderUIDsByCustomerID(c.UserContext(), customerID, lookupLimit)
+	if err != nil {
+		return errors.Wrap(err, "load customer orders")
+	}
+	orders, err := s.ordersByUID(c.UserContext(), uids)
+	if err != nil {
+		return errors.Wrap(err, "load customer orders")
+	}
+	if len(uids) < lookupLimit {
+		lookup.Complete(orders)
+	}
+
+	return s.renderOrders(c, orders)
+}
+
+func (s *OrderService) GetOrdersByChrtID(c *fiber.Ctx) error {
+	chrtID, err := strconv.ParseInt(c.Params("chrt_id"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid chrt_id")
+	}
+
+	if orders, ok := s.cache.GetByChrtID(chrtID); ok {
+		return s.renderOrders(c, orders[:min(len(orders), lookupLimit)])
+	}
+
+	lookup := s.cache.BeginLookup(cache.ByChrtID, strconv.FormatInt(chrtID, 10))
+	defer lookup.End()
+
+	uids, err := s.db.GetOrderUIDsByChrtID(c.UserContext(), chrtID, lookupLimit)
+	if err != nil {
+		return errors.Wrap(err, "load orders by chrt_id")
+	}
+	orders, err := s.ordersByUID(c.UserContext(), uids)
+	if err != nil {
+		return errors.Wrap(err, "load orders by chrt_id")
+	}
+	if len(uids) < lookupLimit {
+		lookup.Complete(orders)
+	}
+
+	return s.renderOrders(c, orders)
+}
+
+// ordersByUID собирает заказы в порядке uids: из кэша, а недостающие — одним
+// запросом к БД. Состав и порядок списка определяет БД; полный список
+// затем запоминается в индексе кэша (см. cache.Lookup.Complete).
+func (s *OrderService) ordersByUID(ctx context.Context, uids []string) ([]db.FullOrder, error) {
+	found := make(map[string]db.FullOrder, len(uids))
+	var missing []string
+	for _, uid := range uids {
+		if order, ok := s.cache.Get(uid); ok {
+			found[uid] = order
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+
+	if len(missing) > 0 {
+		loaded, err := s.db.LoadOrders(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, order := range loaded {
+			s.cache.Set(order)
+			found[order.OrderUID] = order
+		}
+	}
+
+	orders := make([]db.FullOrder, 0, len(uids))
+	for _, uid := range uids {
+		// Заказ мог быть удален между запросами
+		if order, ok := found[uid]; ok {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+// ShapeLegacy — прежняя форма ответа: db.FullOrder с полями в PascalCase
+// (см. legacyOrder). Оставлена для клиентов, которые еще не перешли на snake_case.
+const ShapeLegacy = "legacy"
+
+// legacyOrder повторяет JSON db.FullOrder до появления в нем Status и
+// Version: прежние клиенты получают ответ байт в байт как раньше
+type legacyOrder struct {
+	OrderUID          string `json:"order_uid"`
+	TrackNumber       string
+	Entry             string
+	Locale            string
+	InternalSignature string
+	CustomerID        string
+	DeliveryService   string
+	ShardKey          string
+	SmID              int
+	DateCreated       time.Time
+	OofShard          string
+
+	Delivery db.Delivery
+	Payment  db.Payment
+	Items    []db.Item
+}
+
+// toLegacy не подменяет nil-слайсы: заказ без товаров, как и раньше,
+// отдается с "Items":null
+func toLegacy(o db.FullOrder) legacyOrder {
+	return legacyOrder{
+		OrderUID:          o.OrderUID,
+		TrackNumber:       o.TrackNumber,
+		Entry:             o.Entry,
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerID:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		ShardKey:          o.ShardKey,
+		SmID:              o.SmID,
+		DateCreated:       o.DateCreated,
+		OofShard:          o.OofShard,
+		Delivery:          o.Delivery,
+		Payment:           o.Payment,
+		Items:             o.Items,
+	}
+}
+
+// legacyShape выбирает форму ответа: ?shape=legacy|canonical в запросе,
+// иначе значение по умолчанию из API_LEGACY_SHAPE.
+func (s *OrderService) legacyShape(c *fiber.Ctx) bool {
+	legacy := s.legacyDefault
+	if shape := c.Query("shape"); shape != "" {
+		legacy = shape == ShapeLegacy
+	}
+	if legacy {
+		c.Set("Deprecation", "true")
+	}
+	return legacy
+}
+
+// renderOrder маскирует PII по скоупам вызывающей стороны и отдает заказ
+// в канонической форме models.Order (или в прежней, см. legacyShape)
+func (s *OrderService) renderOrder(c *fiber.Ctx, order db.FullOrder) error {
+	order = s.redactor.Order(c.UserContext(), order)
+	if s.legacyShape(c) {
+		return c.JSON(toLegacy(order))
+	}
+	return c.JSON(order.ToModel())
+}
+
+func (s *OrderService) renderOrders(c *fiber.Ctx, orders []db.FullOrder) error {
+	return c.JSON(s.toResponse(c, orders))
+}
+
+func (s *OrderService) toResponse(c *fiber.Ctx, orders []db.FullOrder) any {
+	orders = s.redactor.Orders(c.UserContext(), orders)
+	if s.legacyShape(c) {
+		out := make([]legacyOrder, len(orders))
+		for i, o := range orders {
+			out[i] = toLegacy(o)
+		}
+		return out
+	}
+
+	out := make([]models.Order, len(orders))
+	for i, o := range orders {
+		out[i] = o.ToModel()
+	}
+	return out
+}
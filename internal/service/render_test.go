@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+// Ответ GET /order/:order_uid до перехода на snake_case для заказа без товаров
+const legacyGolden = `{"order_uid":"b563feb7b2b84b6test","TrackNumber":"WBILMTESTTRACK","Entry":"WBIL","Locale":"en","InternalSignature":"","CustomerID":"test","DeliveryService":"meest","ShardKey":"9","SmID":99,"DateCreated":"2021-11-26T06:22:19Z","OofShard":"1","Delivery":{"Name":"Test Testov","Phone":"+9720000000","Zip":"2639809","City":"Kiryat Mozkin","Address":"Ploshad Mira 15","Region":"Kraiot","Email":"test@gmail.com"},"Payment":{"Transaction":"b563feb7b2b84b6test","RequestID":"","Currency":"USD","Provider":"wbpay","Amount":1817,"PaymentDT":1637907727,"Bank":"alpha","DeliveryCost":1500,"GoodsTotal":317,"CustomFee":0},"Items":null}`
+
+func TestLegacyShapeMatchesBaseline(t *testing.T) {
+	order := db.FullOrder{
+		OrderUID:        "b563feb7b2b84b6test",
+		TrackNumber:     "WBILMTESTTRACK",
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+		// Новых полей в прежней форме нет
+		Status:  "new",
+		Version: 3,
+		Delivery: db.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: db.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDT:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+	}
+
+	got, err := json.Marshal(toLegacy(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != legacyGolden {
+		t.Fatalf("legacy response differs from baseline:\ngot  %s\nwant %s", got, legacyGolden)
+	}
+}
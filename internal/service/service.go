@@ -1,39 +1,75 @@
 package service
 
 import (
+	"context"
+	"log/slog"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
 	"github.com/yakovleviga/brokerService/internal/cache"
+	"github.com/yakovleviga/brokerService/internal/config"
 	"github.com/yakovleviga/brokerService/internal/db"
+	"github.com/yakovleviga/brokerService/internal/logger"
+	"github.com/yakovleviga/brokerService/internal/redact"
+	"github.com/yakovleviga/brokerService/internal/tracing"
 )
 
 type OrderService struct {
-	db    db.Repository
-	cache *cache.Cache
+	db       db.Repository
+	cache    *cache.Cache
+	redactor *redact.Redactor
+	log      *slog.Logger
+	loads    *singleflight.Group
+
+	legacyDefault bool
 }
 
-func NewService(repository db.Repository, cache *cache.Cache) *OrderService {
+func NewService(repository db.Repository, cache *cache.Cache, redactor *redact.Redactor, cfg config.Rest, log *slog.Logger) *OrderService {
 	return &OrderService{
-		db:    repository,
-		cache: cache,
+		db:       repository,
+		cache:    cache,
+		redactor: redactor,
+		log:      log.With("component", "service"),
+		loads:    &singleflight.Group{},
+
+		legacyDefault: cfg.LegacyShape,
 	}
 }
 
+// logger возвращает логгер запроса с request_id
+func (s *OrderService) logger(ctx context.Context) *slog.Logger {
+	return logger.FromContext(ctx, s.log)
+}
+
 func (s *OrderService) GetOrder(c *fiber.Ctx) error {
 	orderUID := c.Params("order_uid")
 	if orderUID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "missing order_uid"})
+		return fiber.NewError(fiber.StatusBadRequest, "missing order_uid")
 	}
 
+	ctx, span := tracing.Start(c.UserContext(), "service.GetOrder",
+		trace.WithAttributes(attribute.String("order.uid", orderUID)))
+	defer span.End()
+
 	order, found := s.cache.Get(orderUID)
+	span.SetAttributes(attribute.Bool("cache.hit", found))
 	if !found {
-
-		orderPtr, err := s.db.GetFullOrder(c.Context(), orderUID)
+		var err error
+		order, err = s.loadOrder(ctx, cache.ByOrderUID, orderUID, func(ctx context.Context) (*db.FullOrder, error) {
+			return s.db.GetFullOrder(ctx, orderUID)
+		})
 		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "order not found"})
+			return errors.Wrapf(err, "load order %s", orderUID)
 		}
-		order = *orderPtr
-		s.cache.Set(order)
 	}
 
-	return c.JSON(order)
+	return s.renderOrder(c, order)
+}
+
+func (s *OrderService) CacheStats(c *fiber.Ctx) error {
+	return c.JSON(s.cache.Stats())
 }
@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yakovleviga/brokerService/internal/broker"
+	"github.com/yakovleviga/brokerService/internal/config"
+)
+
+const tracerName = "github.com/yakovleviga/brokerService"
+
+// Init настраивает глобальный TracerProvider. Возвращает функцию, которая
+// дописывает оставшиеся спаны при остановке сервиса.
+func Init(ctx context.Context, cfg config.Tracing) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.OTLPEndpoint)}
+		if strings.Contains(cfg.OTLPEndpoint, "://") {
+			opts = []otlptracehttp.Option{otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint)}
+		}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, errors.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create span exporter")
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build tracing resource")
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End завершает спан, помечая его ошибкой, если она есть.
+// Используется как defer tracing.End(span, &err).
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// MessageHeaders — TextMapCarrier поверх заголовков сообщения брокера
+type MessageHeaders []broker.Header
+
+func (h *MessageHeaders) Get(key string) string {
+	for _, header := range *h {
+		if strings.EqualFold(header.Key, key) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (h *MessageHeaders) Set(key, value string) {
+	for i, header := range *h {
+		if strings.EqualFold(header.Key, key) {
+			(*h)[i].Value = []byte(value)
+			return
+		}
+	}
+	*h = append(*h, broker.Header{Key: key, Value: []byte(value)})
+}
+
+func (h *MessageHeaders) Keys() []string {
+	keys := make([]string, 0, len(*h))
+	for _, header := range *h {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+// StartConsumerSpan продолжает трейс продюсера из заголовков сообщения
+func StartConsumerSpan(ctx context.Context, m broker.Message) (context.Context, trace.Span) {
+	headers := MessageHeaders(m.Headers)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, &headers)
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemKey.String(m.System),
+		semconv.MessagingDestinationName(m.Topic),
+	}
+	if m.System == broker.Kafka {
+		attrs = append(attrs,
+			semconv.MessagingKafkaOffset(int(m.Offset)),
+			attribute.Int("messaging.kafka.partition", m.Partition),
+			semconv.MessagingKafkaMessageKey(string(m.Key)),
+		)
+	} else {
+		attrs = append(attrs, attribute.Int64("messaging.sequence", m.Offset))
+	}
+
+	return Start(ctx, "orders process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// Inject добавляет текущий контекст трейса в заголовки исходящего сообщения
+func Inject(ctx context.Context, headers []broker.Header) []broker.Header {
+	carrier := MessageHeaders(headers)
+	otel.GetTextMapPropagator().Inject(ctx, &carrier)
+	return carrier
+}
+
+// Middleware создает серверный спан на каждый HTTP-запрос и кладет его
+// контекст в c.UserContext(), откуда его берут сервис и репозиторий.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		carrier := propagation.MapCarrier{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			carrier[strings.ToLower(string(key))] = string(value)
+		})
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+		ctx, span := Start(ctx, c.Method()+" "+c.Path(), trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		span.SetName(c.Method() + " " + c.Route().Path)
+		span.SetAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.HTTPRoute(c.Route().Path),
+			semconv.HTTPResponseStatusCode(status),
+		)
+		if err != nil {
+			span.RecordError(err)
+		}
+		if err != nil || status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+		return err
+	}
+}
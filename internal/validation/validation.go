@@ -0,0 +1,247 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/models"
+)
+
+// Имена правил, которые можно отключить через VALIDATION_DISABLED_RULES
+const (
+	RuleRequired      = "required"
+	RuleNonNegative   = "non_negative"
+	RulePaymentTotal  = "payment_total"
+	RuleItemTrack     = "item_track_number"
+	RuleItemTotal     = "item_total_price"
+	RuleEmail         = "email"
+	RulePhone         = "phone"
+	RuleCurrency      = "currency"
+	RuleSaleRange     = "sale_range"
+	RuleItemsNotEmpty = "items_not_empty"
+)
+
+var phoneRe = regexp.MustCompile(`^\+?[0-9]{10,15}$`)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		parts = append(parts, fe.Field+": "+fe.Message)
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+type Rule struct {
+	Name  string
+	Check func(v *Validator, order models.Order) Errors
+}
+
+type Validator struct {
+	rules      []Rule
+	currencies []string
+}
+
+func NewValidator(cfg config.Validation) *Validator {
+	v := &Validator{currencies: make([]string, 0, len(cfg.Currencies))}
+	for _, c := range cfg.Currencies {
+		v.currencies = append(v.currencies, strings.ToUpper(strings.TrimSpace(c)))
+	}
+
+	for _, rule := range DefaultRules() {
+		if !slices.Contains(cfg.DisabledRules, rule.Name) {
+			v.rules = append(v.rules, rule)
+		}
+	}
+	return v
+}
+
+// Validate прогоняет заказ через все включенные правила и возвращает Errors
+// со всеми найденными нарушениями или nil.
+func (v *Validator) Validate(order models.Order) error {
+	var errs Errors
+	for _, rule := range v.rules {
+		errs = append(errs, rule.Check(v, order)...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ValidateDelivery проверяет только блок доставки, например для событий
+// исправления адреса.
+func (v *Validator) ValidateDelivery(delivery models.Delivery) error {
+	var errs Errors
+	for _, rule := range v.rules {
+		switch rule.Name {
+		case RuleEmail, RulePhone:
+			errs = append(errs, rule.Check(v, models.Order{Delivery: delivery})...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: RuleRequired, Check: checkRequired},
+		{Name: RuleItemsNotEmpty, Check: checkItemsNotEmpty},
+		{Name: RuleNonNegative, Check: checkNonNegative},
+		{Name: RuleSaleRange, Check: checkSaleRange},
+		{Name: RulePaymentTotal, Check: checkPaymentTotal},
+		{Name: RuleItemTrack, Check: checkItemTrackNumber},
+		{Name: RuleItemTotal, Check: checkItemTotalPrice},
+		{Name: RuleEmail, Check: checkEmail},
+		{Name: RulePhone, Check: checkPhone},
+		{Name: RuleCurrency, Check: checkCurrency},
+	}
+}
+
+func checkRequired(_ *Validator, o models.Order) Errors {
+	var errs Errors
+	required := map[string]string{
+		"order_uid":           o.OrderUID,
+		"track_number":        o.TrackNumber,
+		"customer_id":         o.CustomerID,
+		"payment.transaction": o.Payment.Transaction,
+		"payment.currency":    o.Payment.Currency,
+	}
+	for field, value := range required {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, FieldError{Field: field, Rule: RuleRequired, Message: "is required"})
+		}
+	}
+	if o.DateCreated.IsZero() {
+		errs = append(errs, FieldError{Field: "date_created", Rule: RuleRequired, Message: "is required"})
+	}
+	slices.SortFunc(errs, func(a, b FieldError) int { return strings.Compare(a.Field, b.Field) })
+	return errs
+}
+
+func checkItemsNotEmpty(_ *Validator, o models.Order) Errors {
+	if len(o.Items) == 0 {
+		return Errors{{Field: "items", Rule: RuleItemsNotEmpty, Message: "must contain at least one item"}}
+	}
+	return nil
+}
+
+func checkNonNegative(_ *Validator, o models.Order) Errors {
+	var errs Errors
+	add := func(field string, value int) {
+		if value < 0 {
+			errs = append(errs, FieldError{Field: field, Rule: RuleNonNegative, Message: "must not be negative"})
+		}
+	}
+
+	add("payment.amount", o.Payment.Amount)
+	add("payment.delivery_cost", o.Payment.DeliveryCost)
+	add("payment.goods_total", o.Payment.GoodsTotal)
+	add("payment.custom_fee", o.Payment.CustomFee)
+	for i, item := range o.Items {
+		add(fmt.Sprintf("items[%d].price", i), item.Price)
+		add(fmt.Sprintf("items[%d].total_price", i), item.TotalPrice)
+	}
+	return errs
+}
+
+func checkSaleRange(_ *Validator, o models.Order) Errors {
+	var errs Errors
+	for i, item := range o.Items {
+		if item.Sale < 0 || item.Sale > 100 {
+			errs = append(errs, FieldError{
+				Field:   fmt.Sprintf("items[%d].sale", i),
+				Rule:    RuleSaleRange,
+				Message: "must be between 0 and 100",
+			})
+		}
+	}
+	return errs
+}
+
+func checkPaymentTotal(_ *Validator, o models.Order) Errors {
+	p := o.Payment
+	expected := p.GoodsTotal + p.DeliveryCost + p.CustomFee
+	if p.Amount != expected {
+		return Errors{{
+			Field:   "payment.amount",
+			Rule:    RulePaymentTotal,
+			Message: fmt.Sprintf("must equal goods_total + delivery_cost + custom_fee (%d)", expected),
+		}}
+	}
+	return nil
+}
+
+func checkItemTrackNumber(_ *Validator, o models.Order) Errors {
+	var errs Errors
+	for i, item := range o.Items {
+		if item.TrackNumber != o.TrackNumber {
+			errs = append(errs, FieldError{
+				Field:   fmt.Sprintf("items[%d].track_number", i),
+				Rule:    RuleItemTrack,
+				Message: "must match order track_number",
+			})
+		}
+	}
+	return errs
+}
+
+func checkItemTotalPrice(_ *Validator, o models.Order) Errors {
+	var errs Errors
+	for i, item := range o.Items {
+		if item.TotalPrice > item.Price {
+			errs = append(errs, FieldError{
+				Field:   fmt.Sprintf("items[%d].total_price", i),
+				Rule:    RuleItemTotal,
+				Message: "must not exceed price",
+			})
+		}
+	}
+	return errs
+}
+
+func checkEmail(_ *Validator, o models.Order) Errors {
+	email := o.Delivery.Email
+	if email == "" {
+		return nil
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return Errors{{Field: "delivery.email", Rule: RuleEmail, Message: "is not a valid email address"}}
+	}
+	return nil
+}
+
+func checkPhone(_ *Validator, o models.Order) Errors {
+	phone := o.Delivery.Phone
+	if phone == "" {
+		return nil
+	}
+	if !phoneRe.MatchString(phone) {
+		return Errors{{Field: "delivery.phone", Rule: RulePhone, Message: "must contain 10 to 15 digits with optional leading +"}}
+	}
+	return nil
+}
+
+func checkCurrency(v *Validator, o models.Order) Errors {
+	if o.Payment.Currency == "" || len(v.currencies) == 0 {
+		return nil
+	}
+	if !slices.Contains(v.currencies, strings.ToUpper(o.Payment.Currency)) {
+		return Errors{{Field: "payment.currency", Rule: RuleCurrency, Message: "is not a supported currency"}}
+	}
+	return nil
+}
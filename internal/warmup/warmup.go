@@ -0,0 +1,153 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yakovleviga/brokerService/internal/cache"
+	"github.com/yakovleviga/brokerService/internal/config"
+	"github.com/yakovleviga/brokerService/internal/db"
+)
+
+type State string
+
+const (
+	StatePending State = "pending"
+	StateRunning State = "running"
+	StateReady   State = "ready"
+	// StateDegraded — прогрев не завершился, но сервис может отвечать из БД
+	StateDegraded State = "degraded"
+)
+
+type Progress struct {
+	State      State     `json:"state"`
+	Loaded     int64     `json:"loaded"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// errCacheFull останавливает обход БД, когда кэш заполнен
+var errCacheFull = errors.New("cache is full")
+
+// Warmer заполняет кэш из БД пачками и хранит состояние готовности
+type Warmer struct {
+	repo  db.Repository
+	cache *cache.Cache
+	cfg   config.Warmup
+	log   *slog.Logger
+
+	loaded atomic.Int64
+
+	mu       sync.RWMutex
+	progress Progress
+}
+
+func NewWarmer(repo db.Repository, c *cache.Cache, cfg config.Warmup, log *slog.Logger) *Warmer {
+	return &Warmer{
+		repo:     repo,
+		cache:    c,
+		cfg:      cfg,
+		log:      log.With("component", "warmup"),
+		progress: Progress{State: StatePending},
+	}
+}
+
+// Run прогревает кэш и не паникует при ошибках: при таймауте или сбое БД
+// состояние становится degraded, а недостающие заказы подтянутся по запросу.
+func (w *Warmer) Run(ctx context.Context) {
+	if !w.cfg.Enabled {
+		w.finish(StateReady, nil)
+		w.log.Info("cache warm-up disabled")
+		return
+	}
+
+	w.mu.Lock()
+	w.progress.State = StateRunning
+	w.progress.StartedAt = time.Now()
+	w.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+
+	opts := db.StreamOptions{
+		BatchSize: w.cfg.BatchSize,
+		Limit:     w.cfg.MaxOrders,
+	}
+	// Загружать больше, чем вмещает кэш, бессмысленно
+	if maxEntries := w.cache.MaxEntries(); maxEntries > 0 && (opts.Limit == 0 || opts.Limit > maxEntries) {
+		opts.Limit = maxEntries
+	}
+	if w.cfg.MaxAge > 0 {
+		opts.Since = time.Now().Add(-w.cfg.MaxAge)
+	}
+
+	start := time.Now()
+	lastReport := start
+	err := w.repo.StreamOrders(ctx, opts, func(batch []db.FullOrder) error {
+		for i, order := range batch {
+			if !w.cache.Warm(order) {
+				// Лимит по объему: более старые заказы уже не поместятся
+				w.loaded.Add(int64(i))
+				return errCacheFull
+			}
+		}
+		loaded := w.loaded.Add(int64(len(batch)))
+
+		if time.Since(lastReport) >= w.cfg.ProgressInterval {
+			lastReport = time.Now()
+			w.log.Info("cache warm-up in progress", "loaded", loaded, "rate_per_sec", int(float64(loaded)/time.Since(start).Seconds()))
+		}
+		return nil
+	})
+
+	if errors.Is(err, errCacheFull) {
+		err = nil
+	}
+	if err != nil {
+		w.log.Error("cache warm-up degraded", "loaded", w.loaded.Load(), "error", err)
+		w.finish(StateDegraded, err)
+		return
+	}
+
+	w.log.Info("cache warm-up finished", "loaded", w.loaded.Load(), "duration", time.Since(start).Round(time.Millisecond).String())
+	w.finish(StateReady, nil)
+}
+
+func (w *Warmer) finish(state State, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.progress.State = state
+	w.progress.FinishedAt = time.Now()
+	if err != nil {
+		w.progress.Error = err.Error()
+	}
+}
+
+func (w *Warmer) Progress() Progress {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	p := w.progress
+	p.Loaded = w.loaded.Load()
+	return p
+}
+
+// Ready сообщает, можно ли пускать трафик: прогрев завершен или деградировал
+func (w *Warmer) Ready() bool {
+	state := w.Progress().State
+	return state == StateReady || state == StateDegraded
+}
+
+// Check — проверка готовности для health.Checker
+func (w *Warmer) Check(context.Context) error {
+	if w.Ready() {
+		return nil
+	}
+	return errors.New("cache warm-up in progress")
+}